@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/wwq-2020/go.common/log"
@@ -29,6 +30,7 @@ type App struct {
 	cancel        func()
 	wg            sync.WaitGroup
 	shutdownHooks []func()
+	running       int64
 }
 
 // New 创建应用
@@ -56,6 +58,7 @@ func (app *App) Go(f func(context.Context), hooks ...Hook) {
 	app.wg.Add(1)
 	wrappedF := func() {
 		defer app.wg.Done()
+		defer app.track()()
 		ctx := app.Context()
 		for _, hook := range hooks {
 			ctx = hook(ctx)
@@ -70,6 +73,7 @@ func (app *App) GoAsync(f func()) {
 	app.wg.Add(1)
 	wrappedF := func() {
 		defer app.wg.Done()
+		defer app.track()()
 		f()
 	}
 	syncx.SafeGo(wrappedF)
@@ -78,6 +82,7 @@ func (app *App) GoAsync(f func()) {
 // GoForever GoForever
 func (app *App) GoForever(f func(context.Context), hooks ...Hook) {
 	wrapped := func() {
+		defer app.track()()
 		ctx := app.Context()
 		for _, hook := range hooks {
 			ctx = hook(ctx)
@@ -91,9 +96,25 @@ func (app *App) GoForever(f func(context.Context), hooks ...Hook) {
 
 // GoForever GoForever
 func (app *App) GoAsyncForever(f func()) {
+	wrapped := func() {
+		defer app.track()()
+		f()
+	}
 	onStart := func() { app.wg.Add(1) }
 	onStop := func() { app.wg.Done() }
-	syncx.SafeLoopGoex(app.Context(), f, onStart, onStop)
+	syncx.SafeLoopGoex(app.Context(), wrapped, onStart, onStop)
+}
+
+// Running 当前运行中的应用goroutine数
+func (app *App) Running() int64 {
+	return atomic.LoadInt64(&app.running)
+}
+
+func (app *App) track() func() {
+	atomic.AddInt64(&app.running, 1)
+	return func() {
+		atomic.AddInt64(&app.running, -1)
+	}
 }
 
 // Close 结束这个应用
@@ -117,11 +138,13 @@ func (app *App) Wait() {
 		app.Close()
 		app.wg.Wait()
 		log.Info("grace exit")
+		log.Sync()
 		return
 	default:
 	}
 	app.wg.Wait()
 	log.Info("grace exit")
+	log.Sync()
 }
 
 // AddChild 添加子应用
@@ -212,6 +235,12 @@ func Context() context.Context {
 	return globalApp.Context()
 }
 
+// Running 当前运行中的应用goroutine数
+func Running() int64 {
+	setupOnce.Do(setup)
+	return globalApp.Running()
+}
+
 // AddChild 添加子应用
 func AddChild(child *App) {
 	setupOnce.Do(setup)
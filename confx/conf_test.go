@@ -31,3 +31,33 @@ func TestRender(t *testing.T) {
 	}
 	fmt.Println(c)
 }
+
+type nullableConf struct {
+	Name  string `toml:"name"`
+	Admin *struct {
+		Addr string `toml:"addr"`
+	} `toml:"admin" nullable:"true"`
+}
+
+func TestParseNullablePtr(t *testing.T) {
+	c := &nullableConf{}
+	if err := confx.Parse([]byte(`name = "a"`), c); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if c.Admin != nil {
+		t.Fatalf("expected:%v,got:%v", nil, c.Admin)
+	}
+
+	c = &nullableConf{}
+	if err := confx.Parse([]byte("name = \"a\"\n[admin]\n"), c); err == nil {
+		t.Fatal("expected empty key error for admin.addr")
+	}
+
+	c = &nullableConf{}
+	if err := confx.Parse([]byte("name = \"a\"\n[admin]\naddr = \":8081\"\n"), c); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if c.Admin == nil || c.Admin.Addr != ":8081" {
+		t.Fatalf("expected:%v,got:%v", ":8081", c.Admin)
+	}
+}
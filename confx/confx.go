@@ -140,6 +140,9 @@ func walk(t reflect.Type, v reflect.Value, ancestors []string, tag string, walke
 	}
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
+		if field.Tag.Get(tag) == "-" {
+			continue
+		}
 		fieldType := field.Type
 		fieldValue := v.Field(i)
 		if err := walker(&Field{
@@ -151,6 +154,10 @@ func walk(t reflect.Type, v reflect.Value, ancestors []string, tag string, walke
 		}
 
 		if fieldType.Kind() == reflect.Ptr {
+			// 可为空的字段未配置时无需检查其子字段
+			if fieldValue.IsNil() {
+				continue
+			}
 			fieldType = fieldType.Elem()
 		}
 		if fieldType.Kind() != reflect.Struct {
@@ -0,0 +1,125 @@
+package confx
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// consts
+const (
+	SecretTag  = "secret"
+	MaskedText = "******"
+)
+
+var (
+	sensitiveKeys = []string{"password", "passwd", "secret", "token", "credential", "private"}
+)
+
+// Snapshot 把配置转成可展示的map,敏感字段打码
+// 只导出带有tag的字段,tag为secret:"true"或key包含敏感词的字段会被打码
+func Snapshot(src interface{}, tag string) interface{} {
+	return snapshot(reflect.ValueOf(src), tag)
+}
+
+func snapshot(v reflect.Value, tag string) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return snapshot(v.Elem(), tag)
+	case reflect.Struct:
+		result := make(map[string]interface{}, v.NumField())
+		snapshotStruct(v, tag, result)
+		return result
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		result := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, snapshot(v.Index(i), tag))
+		}
+		return result
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		result := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := mapKeyString(iter.Key())
+			if isSensitiveKey(key) {
+				result[key] = MaskedText
+				continue
+			}
+			result[key] = snapshot(iter.Value(), tag)
+		}
+		return result
+	default:
+		return v.Interface()
+	}
+}
+
+func snapshotStruct(v reflect.Value, tag string, result map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tagValue, ok := field.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tagValue, ",")
+		key := parts[0]
+		if key == "-" {
+			continue
+		}
+		fieldValue := v.Field(i)
+		if hasInlineTag(parts[1:]) {
+			for fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil() {
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				snapshotStruct(fieldValue, tag, result)
+			}
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		if isSecretField(field) || isSensitiveKey(key) {
+			result[key] = MaskedText
+			continue
+		}
+		result[key] = snapshot(fieldValue, tag)
+	}
+}
+
+func isSecretField(field reflect.StructField) bool {
+	secret, err := strconv.ParseBool(field.Tag.Get(SecretTag))
+	return err == nil && secret
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, each := range sensitiveKeys {
+		if strings.Contains(key, each) {
+			return true
+		}
+	}
+	return false
+}
+
+func mapKeyString(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
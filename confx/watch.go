@@ -0,0 +1,199 @@
+package confx
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/syncx"
+	etcd "go.etcd.io/etcd/client/v3"
+)
+
+// vars
+var (
+	DefaultWatchInterval = time.Second
+)
+
+// Source 配置来源
+type Source interface {
+	// Read 读取当前内容
+	Read(ctx context.Context) ([]byte, error)
+	// Watch 推送变化后的内容,ctx结束时关闭
+	Watch(ctx context.Context) <-chan []byte
+}
+
+type fileSource struct {
+	file     string
+	interval time.Duration
+}
+
+// NewFileSource 按interval轮询文件内容
+func NewFileSource(file string, interval time.Duration) Source {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &fileSource{file: file, interval: interval}
+}
+
+func (s *fileSource) Read(ctx context.Context) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return data, nil
+}
+
+func (s *fileSource) Watch(ctx context.Context) <-chan []byte {
+	ch := make(chan []byte)
+	syncx.SafeGo(func() {
+		defer close(ch)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		var last []byte
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			data, err := s.Read(ctx)
+			if err != nil {
+				log.WithField("file", s.file).
+					ErrorContext(ctx, err)
+				continue
+			}
+			if last != nil && bytes.Equal(last, data) {
+				continue
+			}
+			last = data
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- data:
+			}
+		}
+	})
+	return ch
+}
+
+type etcdSource struct {
+	client *etcd.Client
+	key    string
+}
+
+// NewEtcdSource 监听etcd中的key
+func NewEtcdSource(client *etcd.Client, key string) Source {
+	return &etcdSource{client: client, key: key}
+}
+
+func (s *etcdSource) Read(ctx context.Context) ([]byte, error) {
+	kvResp, err := s.client.KV.Get(ctx, s.key)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	if len(kvResp.Kvs) == 0 {
+		return nil, errorsx.Trace(EmptyKey).WithField("key", s.key)
+	}
+	return kvResp.Kvs[0].Value, nil
+}
+
+func (s *etcdSource) Watch(ctx context.Context) <-chan []byte {
+	ch := make(chan []byte)
+	syncx.SafeGo(func() {
+		defer close(ch)
+		for watchResp := range s.client.Watch(ctx, s.key) {
+			if err := watchResp.Err(); err != nil {
+				log.WithField("key", s.key).
+					ErrorContext(ctx, err)
+				continue
+			}
+			for _, event := range watchResp.Events {
+				if event.Type != etcd.EventTypePut {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- event.Kv.Value:
+				}
+			}
+		}
+	})
+	return ch
+}
+
+// Watch 解析source中keyPath处的配置,keyPath为空时解析整个文档,
+// 先推送当前配置,之后每次变化推送newDest返回的新结构,解析失败的内容会被忽略
+func Watch(ctx context.Context, source Source, keyPath string, newDest func() interface{}) (<-chan interface{}, error) {
+	data, err := source.Read(ctx)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	dest := newDest()
+	if err := ParseKeyPath(data, keyPath, dest); err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	ch := make(chan interface{}, 1)
+	ch <- dest
+	changes := source.Watch(ctx)
+	syncx.SafeGo(func() {
+		defer close(ch)
+		last := data
+		for data := range changes {
+			if bytes.Equal(last, data) {
+				continue
+			}
+			last = data
+			dest := newDest()
+			if err := ParseKeyPath(data, keyPath, dest); err != nil {
+				log.WithField("keyPath", keyPath).
+					ErrorContext(ctx, err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- dest:
+			}
+		}
+	})
+	return ch, nil
+}
+
+// ParseKeyPath 解析data中以.分隔的keyPath处的配置
+func ParseKeyPath(data []byte, keyPath string, dest interface{}) error {
+	if keyPath == "" {
+		if err := Parse(data, dest); err != nil {
+			return errorsx.Trace(err)
+		}
+		return nil
+	}
+	data, err := Render(data)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return errorsx.Trace(err)
+	}
+	for _, key := range strings.Split(keyPath, ".") {
+		sub, ok := doc[key].(map[string]interface{})
+		if !ok {
+			return errorsx.Trace(ErrKeyNil).WithField("key", keyPath)
+		}
+		doc = sub
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(buf).Encode(doc); err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := Parse(buf.Bytes(), dest); err != nil {
+		return errorsx.Trace(err).WithField("key", keyPath)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package errorsx
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/wwq-2020/go.common/errcode"
+	"github.com/wwq-2020/go.common/stack"
+)
+
+// Frame 一层调用栈
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Cause 错误链中的一层
+type Cause struct {
+	Message string
+	Code    errcode.ErrCode
+	Tip     string
+	Fields  stack.Fields
+	// Stack 原始的调用栈字符串,非StackError时为空
+	Stack string
+}
+
+// Frames 解析Stack为结构化的调用栈
+func (c *Cause) Frames() []*Frame {
+	if c.Stack == "" {
+		return nil
+	}
+	parts := strings.Split(c.Stack, ",")
+	frames := make([]*Frame, 0, len(parts))
+	for _, part := range parts {
+		frame := &Frame{Function: part}
+		if idx := strings.IndexByte(part, '@'); idx >= 0 {
+			frame.Function = part[:idx]
+			frame.File = part[idx+1:]
+			if idx := strings.LastIndexByte(frame.File, ':'); idx >= 0 {
+				if line, err := strconv.Atoi(frame.File[idx+1:]); err == nil {
+					frame.Line = line
+					frame.File = frame.File[:idx]
+				}
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// Chain 从外到内展开错误链,与上一层消息相同且没有额外信息的层会被跳过
+func Chain(err error) []*Cause {
+	var causes []*Cause
+	for ; err != nil; err = errors.Unwrap(err) {
+		se, ok := err.(*stackError)
+		if !ok {
+			if len(causes) > 0 && causes[len(causes)-1].Message == err.Error() {
+				continue
+			}
+			causes = append(causes, &Cause{Message: err.Error()})
+			continue
+		}
+		cause := &Cause{
+			Message: se.Error(),
+			Code:    se.code,
+			Tip:     se.tip,
+			Fields:  se.fields,
+			Stack:   se.stack,
+		}
+		if cause.Fields == nil {
+			cause.Fields = stack.New()
+		}
+		causes = append(causes, cause)
+	}
+	return causes
+}
@@ -0,0 +1,309 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+// errs
+var (
+	ErrCircuitOpen  = errorsx.Std("circuit breaker open")
+	ErrBulkheadFull = errorsx.Std("bulkhead full")
+)
+
+// vars
+var (
+	DefaultBreakerFailureThreshold    = 5
+	DefaultBreakerOpenTimeout         = 30 * time.Second
+	DefaultBreakerOpenTimeoutStr      = DefaultBreakerOpenTimeout.String()
+	DefaultBreakerHalfOpenMaxRequests = 1
+	DefaultBulkheadMaxConcurrent      = 100
+)
+
+// BreakerState BreakerState
+type BreakerState int
+
+// BreakerStates
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+// String String
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConf BreakerConf
+type BreakerConf struct {
+	FailureThreshold    *int    `toml:"failure_threshold" yaml:"failure_threshold" json:"failure_threshold"`
+	OpenTimeout         *string `toml:"open_timeout" yaml:"open_timeout" json:"open_timeout"`
+	HalfOpenMaxRequests *int    `toml:"half_open_max_requests" yaml:"half_open_max_requests" json:"half_open_max_requests"`
+}
+
+func (c *BreakerConf) fill() {
+	if c.FailureThreshold == nil || *c.FailureThreshold <= 0 {
+		c.FailureThreshold = &DefaultBreakerFailureThreshold
+	}
+	if c.OpenTimeout == nil || *c.OpenTimeout == "" {
+		c.OpenTimeout = &DefaultBreakerOpenTimeoutStr
+	}
+	if c.HalfOpenMaxRequests == nil || *c.HalfOpenMaxRequests <= 0 {
+		c.HalfOpenMaxRequests = &DefaultBreakerHalfOpenMaxRequests
+	}
+}
+
+// BulkheadConf BulkheadConf
+type BulkheadConf struct {
+	MaxConcurrent *int `toml:"max_concurrent" yaml:"max_concurrent" json:"max_concurrent"`
+}
+
+func (c *BulkheadConf) fill() {
+	if c.MaxConcurrent == nil || *c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = &DefaultBulkheadMaxConcurrent
+	}
+}
+
+type hostBreaker struct {
+	host      string
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	halfOpens int
+	sync.Mutex
+}
+
+func (b *hostBreaker) setState(state BreakerState) {
+	if b.state != state {
+		log.WithField("host", b.host).
+			WithField("from", b.state).
+			WithField("to", state).
+			Warn("circuit breaker state changed")
+	}
+	b.state = state
+	circuitBreakerState.WithLabelValues(b.host).Set(float64(state))
+}
+
+type breakerTransport struct {
+	rt                  http.RoundTripper
+	failureThreshold    int
+	openTimeout         time.Duration
+	halfOpenMaxRequests int
+	breakers            map[string]*hostBreaker
+	sync.Mutex
+}
+
+// BreakerTransport 按host熔断,连续失败达到阈值后打开,openTimeout后进入半开状态试探
+func BreakerTransport(rt http.RoundTripper, conf *BreakerConf) http.RoundTripper {
+	if conf == nil {
+		conf = &BreakerConf{}
+	}
+	conf.fill()
+	openTimeout, err := time.ParseDuration(*conf.OpenTimeout)
+	if err != nil || openTimeout <= 0 {
+		openTimeout = DefaultBreakerOpenTimeout
+	}
+	if err != nil {
+		log.WithField("open_timeout", *conf.OpenTimeout).
+			Error(err)
+	}
+	return &breakerTransport{
+		rt:                  rt,
+		failureThreshold:    *conf.FailureThreshold,
+		openTimeout:         openTimeout,
+		halfOpenMaxRequests: *conf.HalfOpenMaxRequests,
+		breakers:            make(map[string]*hostBreaker),
+	}
+}
+
+func (t *breakerTransport) breaker(host string) *hostBreaker {
+	t.Lock()
+	defer t.Unlock()
+	b, exist := t.breakers[host]
+	if !exist {
+		b = &hostBreaker{host: host}
+		t.breakers[host] = b
+		circuitBreakerState.WithLabelValues(host).Set(float64(BreakerClosed))
+	}
+	return b
+}
+
+func (t *breakerTransport) allow(b *hostBreaker) bool {
+	b.Lock()
+	defer b.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < t.openTimeout {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.halfOpens = 1
+		return true
+	case BreakerHalfOpen:
+		if b.halfOpens >= t.halfOpenMaxRequests {
+			return false
+		}
+		b.halfOpens++
+		return true
+	default:
+		return true
+	}
+}
+
+func (t *breakerTransport) done(b *hostBreaker, failed bool) {
+	b.Lock()
+	defer b.Unlock()
+	if !failed {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.halfOpens--
+		}
+		b.setState(BreakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= t.failureThreshold {
+		b.openedAt = time.Now()
+		b.halfOpens = 0
+		b.setState(BreakerOpen)
+	}
+}
+
+// release 不计成功也不计失败,只归还半开状态占用的名额
+func (t *breakerTransport) release(b *hostBreaker) {
+	b.Lock()
+	defer b.Unlock()
+	if b.state == BreakerHalfOpen && b.halfOpens > 0 {
+		b.halfOpens--
+	}
+}
+
+// isHostFailure 调用方取消、超时以及本地限流不代表host故障
+func isHostFailure(err error) bool {
+	return !errorsx.StdIs(err, context.Canceled) &&
+		!errorsx.StdIs(err, context.DeadlineExceeded) &&
+		!errorsx.StdIs(err, ErrRateLimited)
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b := t.breaker(host)
+	if !t.allow(b) {
+		circuitBreakerRejected.WithLabelValues(host).Inc()
+		closeBody(req.Body)
+		return nil, errorsx.Trace(ErrCircuitOpen).
+			WithField("host", host)
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		if isHostFailure(err) {
+			t.done(b, true)
+		} else {
+			t.release(b)
+		}
+		return nil, errorsx.Trace(err)
+	}
+	t.done(b, resp.StatusCode >= http.StatusInternalServerError)
+	return resp, nil
+}
+
+// BreakerMiddleware BreakerMiddleware
+func BreakerMiddleware(conf *BreakerConf) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return BreakerTransport(rt, conf)
+	}
+}
+
+type bulkheadTransport struct {
+	rt            http.RoundTripper
+	maxConcurrent int
+	slots         map[string]chan struct{}
+	sync.Mutex
+}
+
+// BulkheadTransport 限制每个host的并发请求数,超出时直接失败
+func BulkheadTransport(rt http.RoundTripper, conf *BulkheadConf) http.RoundTripper {
+	if conf == nil {
+		conf = &BulkheadConf{}
+	}
+	conf.fill()
+	return &bulkheadTransport{
+		rt:            rt,
+		maxConcurrent: *conf.MaxConcurrent,
+		slots:         make(map[string]chan struct{}),
+	}
+}
+
+func (t *bulkheadTransport) hostSlots(host string) chan struct{} {
+	t.Lock()
+	defer t.Unlock()
+	slots, exist := t.slots[host]
+	if !exist {
+		slots = make(chan struct{}, t.maxConcurrent)
+		t.slots[host] = slots
+	}
+	return slots
+}
+
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	slots := t.hostSlots(host)
+	select {
+	case slots <- struct{}{}:
+	default:
+		bulkheadRejected.WithLabelValues(host).Inc()
+		closeBody(req.Body)
+		return nil, errorsx.Trace(ErrBulkheadFull).
+			WithField("host", host)
+	}
+	inflight := bulkheadInflight.WithLabelValues(host)
+	inflight.Inc()
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			inflight.Dec()
+			<-slots
+		})
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, errorsx.Trace(err)
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// BulkheadMiddleware BulkheadMiddleware
+func BulkheadMiddleware(conf *BulkheadConf) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return BulkheadTransport(rt, conf)
+	}
+}
+
+// releaseBody body关闭时释放并发槽位
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
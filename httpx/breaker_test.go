@@ -0,0 +1,100 @@
+package httpx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestBreakerTransport(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	maxRetry := 1
+	threshold := 2
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			MaxRetry: &maxRetry,
+			Breaker: &httpx.BreakerConf{
+				FailureThreshold: &threshold,
+			},
+		},
+	})
+	for i := 0; i < 3; i++ {
+		httpx.Get(context.TODO(), srv.URL, nil, httpx.WithClient(client))
+	}
+	if calls != 2 {
+		t.Fatalf("expected:%d,got:%d", 2, calls)
+	}
+	err := httpx.Get(context.TODO(), srv.URL, nil, httpx.WithClient(client))
+	if !errorsx.StdIs(err, httpx.ErrCircuitOpen) {
+		t.Fatalf("expected:%v,got:%v", httpx.ErrCircuitOpen, err)
+	}
+}
+
+func TestBulkheadTransport(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+	defer close(block)
+	maxConcurrent := 1
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			Bulkhead: &httpx.BulkheadConf{
+				MaxConcurrent: &maxConcurrent,
+			},
+		},
+	})
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		httpx.Get(context.TODO(), srv.URL, nil, httpx.WithClient(client))
+	}()
+	<-started
+	var err error
+	for i := 0; i < 100; i++ {
+		if err = httpx.Get(context.TODO(), srv.URL, nil, httpx.WithClient(client)); errorsx.StdIs(err, httpx.ErrBulkheadFull) {
+			return
+		}
+	}
+	t.Fatalf("expected:%v,got:%v", httpx.ErrBulkheadFull, err)
+}
+
+func TestBreakerTransportIgnoresCallerErrors(t *testing.T) {
+	var calls int32
+	rt := httpx.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, context.Canceled
+		}
+		return nil, httpx.ErrRateLimited
+	})
+	threshold := 1
+	breaker := httpx.BreakerTransport(rt, &httpx.BreakerConf{
+		FailureThreshold: &threshold,
+	})
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if _, err := breaker.RoundTrip(req); errorsx.StdIs(err, httpx.ErrCircuitOpen) {
+			t.Fatalf("expected:%v,got:%v", "not open", err)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("expected:%d,got:%d", 3, calls)
+	}
+}
+
+func TestBreakerStateString(t *testing.T) {
+	if got := httpx.BreakerHalfOpen.String(); got != "half-open" {
+		t.Fatalf("expected:%s,got:%s", "half-open", got)
+	}
+}
@@ -0,0 +1,627 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/syncx"
+)
+
+// consts
+const (
+	CacheControlHeader    = "Cache-Control"
+	ETagHeader            = "ETag"
+	LastModifiedHeader    = "Last-Modified"
+	IfNoneMatchHeader     = "If-None-Match"
+	IfModifiedSinceHeader = "If-Modified-Since"
+	CacheStorageMemory    = "memory"
+	CacheStorageDisk      = "disk"
+	varyHeaderPrefix      = "X-Httpx-Varied-"
+	responseTimeHeader    = "X-Httpx-Response-Time"
+)
+
+// cache results
+const (
+	cacheHit         = "hit"
+	cacheMiss        = "miss"
+	cacheRevalidated = "revalidated"
+	cacheStale       = "stale"
+)
+
+// vars
+var (
+	DefaultCacheStorage  = CacheStorageMemory
+	DefaultCacheMaxBytes = int64(64 << 20)
+	// DefaultCacheMaxEntryBytes 超过该大小或长度未知的响应不缓存,避免大文件下载被整体缓冲
+	DefaultCacheMaxEntryBytes = int64(1 << 20)
+	DefaultCacheDir           = filepath.Join(os.TempDir(), "httpx-cache")
+	safeMethods               = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+	}
+	cacheableStatusCodes = map[int]bool{
+		http.StatusOK:                   true,
+		http.StatusNonAuthoritativeInfo: true,
+		http.StatusMultipleChoices:      true,
+		http.StatusMovedPermanently:     true,
+		http.StatusNotFound:             true,
+		http.StatusGone:                 true,
+	}
+)
+
+// CacheStorage 缓存存储,key为请求方法和URL
+type CacheStorage interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// CacheConf CacheConf
+type CacheConf struct {
+	// Storage memory或disk
+	Storage  *string `toml:"storage" yaml:"storage" json:"storage"`
+	MaxBytes *int64  `toml:"max_bytes" yaml:"max_bytes" json:"max_bytes"`
+	Dir      *string `toml:"dir" yaml:"dir" json:"dir"`
+	// MaxEntryBytes 单个响应的最大字节数
+	MaxEntryBytes *int64 `toml:"max_entry_bytes" yaml:"max_entry_bytes" json:"max_entry_bytes" nullable:"true"`
+}
+
+func (c *CacheConf) fill() {
+	if c.Storage == nil || *c.Storage == "" {
+		c.Storage = &DefaultCacheStorage
+	}
+	if c.MaxBytes == nil || *c.MaxBytes <= 0 {
+		c.MaxBytes = &DefaultCacheMaxBytes
+	}
+	if c.Dir == nil || *c.Dir == "" {
+		c.Dir = &DefaultCacheDir
+	}
+	if c.MaxEntryBytes == nil || *c.MaxEntryBytes <= 0 {
+		c.MaxEntryBytes = &DefaultCacheMaxEntryBytes
+	}
+}
+
+// MakeCacheStorage MakeCacheStorage
+func MakeCacheStorage(conf *CacheConf) (CacheStorage, error) {
+	if conf == nil {
+		conf = &CacheConf{}
+	}
+	conf.fill()
+	switch *conf.Storage {
+	case CacheStorageMemory:
+		return NewMemoryCacheStorage(*conf.MaxBytes), nil
+	case CacheStorageDisk:
+		storage, err := NewDiskCacheStorage(*conf.Dir)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		return storage, nil
+	default:
+		return nil, errorsx.New("unknown cache storage").
+			WithField("storage", *conf.Storage)
+	}
+}
+
+type memoryCacheEntry struct {
+	key   string
+	value []byte
+}
+
+type memoryCacheStorage struct {
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	entries  map[string]*list.Element
+	sync.Mutex
+}
+
+// NewMemoryCacheStorage 内存LRU存储,总字节数超过maxBytes时淘汰最久未使用的条目
+func NewMemoryCacheStorage(maxBytes int64) CacheStorage {
+	return &memoryCacheStorage{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *memoryCacheStorage) Get(key string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+	e, exist := s.entries[key]
+	if !exist {
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*memoryCacheEntry).value, true
+}
+
+func (s *memoryCacheStorage) Set(key string, value []byte) {
+	s.Lock()
+	defer s.Unlock()
+	if e, exist := s.entries[key]; exist {
+		s.remove(e)
+	}
+	if int64(len(value)) > s.maxBytes {
+		return
+	}
+	s.entries[key] = s.ll.PushFront(&memoryCacheEntry{key: key, value: value})
+	s.size += int64(len(value))
+	for s.size > s.maxBytes {
+		s.remove(s.ll.Back())
+	}
+}
+
+func (s *memoryCacheStorage) Delete(key string) {
+	s.Lock()
+	defer s.Unlock()
+	if e, exist := s.entries[key]; exist {
+		s.remove(e)
+	}
+}
+
+func (s *memoryCacheStorage) remove(e *list.Element) {
+	entry := s.ll.Remove(e).(*memoryCacheEntry)
+	delete(s.entries, entry.key)
+	s.size -= int64(len(entry.value))
+}
+
+type diskCacheStorage struct {
+	dir string
+}
+
+// NewDiskCacheStorage 每个条目存为dir下的一个文件
+func NewDiskCacheStorage(dir string) (CacheStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return &diskCacheStorage{dir: dir}, nil
+}
+
+func (s *diskCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *diskCacheStorage) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *diskCacheStorage) Set(key string, value []byte) {
+	path := s.path(key)
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		log.WithField("dir", s.dir).
+			Error(errorsx.Trace(err))
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		log.WithField("path", path).
+			Error(errorsx.Trace(err))
+	}
+}
+
+func (s *diskCacheStorage) Delete(key string) {
+	os.Remove(s.path(key))
+}
+
+type cacheTransport struct {
+	rt            http.RoundTripper
+	storage       CacheStorage
+	maxEntryBytes int64
+	revalidations map[string]bool
+	sync.Mutex
+}
+
+// CacheTransport 按RFC 7234缓存GET响应,支持max-age、no-store、ETag/Last-Modified协商及stale-while-revalidate
+func CacheTransport(rt http.RoundTripper, storage CacheStorage) http.RoundTripper {
+	return CacheTransportEx(rt, storage, DefaultCacheMaxEntryBytes)
+}
+
+// CacheTransportEx 响应body在调用方读取时写入缓存,长度未知或超过maxEntryBytes的响应不缓存
+func CacheTransportEx(rt http.RoundTripper, storage CacheStorage, maxEntryBytes int64) http.RoundTripper {
+	return &cacheTransport{
+		rt:            rt,
+		storage:       storage,
+		maxEntryBytes: maxEntryBytes,
+		revalidations: make(map[string]bool),
+	}
+}
+
+// CacheMiddleware CacheMiddleware
+func CacheMiddleware(storage CacheStorage) RoundTripperMiddleware {
+	return CacheMiddlewareEx(storage, DefaultCacheMaxEntryBytes)
+}
+
+// CacheMiddlewareEx CacheMiddlewareEx
+func CacheMiddlewareEx(storage CacheStorage, maxEntryBytes int64) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return CacheTransportEx(rt, storage, maxEntryBytes)
+	}
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	reqCacheControl := parseCacheControl(req.Header)
+	key := cacheKey(req)
+	if req.Method != http.MethodGet {
+		resp, err := t.rt.RoundTrip(req)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		if !safeMethods[req.Method] && resp.StatusCode < http.StatusBadRequest {
+			t.storage.Delete(http.MethodGet + " " + req.URL.String())
+		}
+		return resp, nil
+	}
+	if reqCacheControl.has("no-store") || req.Header.Get("Range") != "" {
+		return t.rt.RoundTrip(req)
+	}
+	cached := t.load(key, req)
+	if cached == nil {
+		cacheRequests.WithLabelValues(host, cacheMiss).Inc()
+		return t.fetch(key, req, nil)
+	}
+	respCacheControl := parseCacheControl(cached.Header)
+	age := responseAge(cached)
+	lifetime := freshnessLifetime(cached, respCacheControl)
+	if !reqCacheControl.has("no-cache") && !respCacheControl.has("no-cache") {
+		if age < lifetime {
+			cacheRequests.WithLabelValues(host, cacheHit).Inc()
+			return cached, nil
+		}
+		if swr, ok := respCacheControl.duration("stale-while-revalidate"); ok &&
+			!respCacheControl.has("must-revalidate") && age < lifetime+swr {
+			cacheRequests.WithLabelValues(host, cacheStale).Inc()
+			t.revalidateAsync(key, req, cached)
+			return cached, nil
+		}
+	}
+	resp, err := t.fetch(key, req, cached)
+	if err != nil {
+		cached.Body.Close()
+		return nil, errorsx.Trace(err)
+	}
+	if resp != cached {
+		cached.Body.Close()
+		cacheRequests.WithLabelValues(host, cacheMiss).Inc()
+		return resp, nil
+	}
+	cacheRequests.WithLabelValues(host, cacheRevalidated).Inc()
+	return resp, nil
+}
+
+func (t *cacheTransport) revalidateAsync(key string, req *http.Request, cached *http.Response) {
+	t.Lock()
+	if t.revalidations[key] {
+		t.Unlock()
+		return
+	}
+	t.revalidations[key] = true
+	t.Unlock()
+	req = req.Clone(context.Background())
+	staleHeader := cached.Header.Clone()
+	syncx.SafeGo(func() {
+		defer func() {
+			t.Lock()
+			delete(t.revalidations, key)
+			t.Unlock()
+		}()
+		stale := &http.Response{Header: staleHeader, Body: http.NoBody}
+		resp, err := t.fetch(key, req, stale)
+		if err != nil {
+			log.WithField("url", req.URL.String()).
+				Error(err)
+			return
+		}
+		// 读完body才会写入缓存
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	})
+}
+
+// fetch cached非空时发起条件请求,304时刷新cached的头并返回cached
+func (t *cacheTransport) fetch(key string, req *http.Request, cached *http.Response) (*http.Response, error) {
+	if cached != nil {
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get(ETagHeader); etag != "" && req.Header.Get(IfNoneMatchHeader) == "" {
+			req.Header.Set(IfNoneMatchHeader, etag)
+		}
+		if lastModified := cached.Header.Get(LastModifiedHeader); lastModified != "" && req.Header.Get(IfModifiedSinceHeader) == "" {
+			req.Header.Set(IfModifiedSinceHeader, lastModified)
+		}
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		for name, values := range resp.Header {
+			cached.Header[name] = values
+		}
+		if resp.Header.Get("Date") == "" {
+			cached.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		}
+		cached.Header.Del("Age")
+		cached.Header.Set(responseTimeHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+		if data, ok := t.storage.Get(key); ok {
+			if stored, err := readCachedResponse(data, req); err == nil {
+				stored.Header = cached.Header
+				t.store(key, req, stored)
+			}
+		}
+		return cached, nil
+	}
+	if !cacheableResponse(req, resp) ||
+		resp.ContentLength < 0 || resp.ContentLength > t.maxEntryBytes {
+		t.storage.Delete(key)
+		return resp, nil
+	}
+	stored := t.prepareStore(req, resp)
+	resp.Body = &cacheBody{
+		ReadCloser: resp.Body,
+		buf:        bytes.NewBuffer(make([]byte, 0, resp.ContentLength)),
+		size:       resp.ContentLength,
+		onDone: func(body []byte) {
+			if err := t.storeBody(key, stored, body); err != nil {
+				log.WithField("url", req.URL.String()).
+					Error(err)
+			}
+		},
+	}
+	return resp, nil
+}
+
+// cacheBody 调用方完整读取body后写入缓存,中途关闭则不缓存
+type cacheBody struct {
+	io.ReadCloser
+	buf    *bytes.Buffer
+	size   int64
+	onDone func([]byte)
+	done   bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *cacheBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *cacheBody) finish() {
+	if b.done {
+		return
+	}
+	b.done = true
+	if int64(b.buf.Len()) == b.size {
+		b.onDone(b.buf.Bytes())
+	}
+}
+
+// store 读取并恢复resp的body后写入缓存
+func (t *cacheTransport) store(key string, req *http.Request, resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err := t.storeBody(key, t.prepareStore(req, resp), body); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+// prepareStore 复制响应头,请求头中被Vary引用的值随响应一起保存
+func (t *cacheTransport) prepareStore(req *http.Request, resp *http.Response) *http.Response {
+	stored := *resp
+	stored.Header = resp.Header.Clone()
+	stored.TransferEncoding = nil
+	if stored.Header.Get("Date") == "" {
+		stored.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if stored.Header.Get(responseTimeHeader) == "" {
+		stored.Header.Set(responseTimeHeader, strconv.FormatInt(time.Now().UnixNano(), 10))
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		stored.Header.Set(varyHeaderPrefix+name, req.Header.Get(name))
+	}
+	return &stored
+}
+
+func (t *cacheTransport) storeBody(key string, stored *http.Response, body []byte) error {
+	stored.Body = ioutil.NopCloser(bytes.NewReader(body))
+	stored.ContentLength = int64(len(body))
+	data, err := httputil.DumpResponse(stored, true)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	t.storage.Set(key, data)
+	return nil
+}
+
+func (t *cacheTransport) load(key string, req *http.Request) *http.Response {
+	data, ok := t.storage.Get(key)
+	if !ok {
+		return nil
+	}
+	resp, err := readCachedResponse(data, req)
+	if err != nil {
+		t.storage.Delete(key)
+		return nil
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if resp.Header.Get(varyHeaderPrefix+name) != req.Header.Get(name) {
+			resp.Body.Close()
+			return nil
+		}
+	}
+	return resp
+}
+
+func readCachedResponse(data []byte, req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return resp, nil
+}
+
+// cacheableResponse 缓存key不含Authorization,带Authorization的请求只在响应显式允许共享时缓存
+func cacheableResponse(req *http.Request, resp *http.Response) bool {
+	if !cacheableStatusCodes[resp.StatusCode] {
+		return false
+	}
+	cacheControl := parseCacheControl(resp.Header)
+	if cacheControl.has("no-store") {
+		return false
+	}
+	if req.Header.Get(AuthorizationHeader) != "" &&
+		!cacheControl.has("public") &&
+		!cacheControl.has("must-revalidate") &&
+		!cacheControl.has("s-maxage") {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if _, ok := cacheControl.duration("max-age"); ok {
+		return true
+	}
+	return resp.Header.Get("Expires") != "" ||
+		resp.Header.Get(ETagHeader) != "" ||
+		resp.Header.Get(LastModifiedHeader) != ""
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func responseDate(resp *http.Response) time.Time {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// responseAge 按RFC 7234 4.2.3计算,max(apparent_age, age_value) + resident_time
+func responseAge(resp *http.Response) time.Duration {
+	date := responseDate(resp)
+	responseTime := date
+	if nanos, err := strconv.ParseInt(resp.Header.Get(responseTimeHeader), 10, 64); err == nil {
+		responseTime = time.Unix(0, nanos)
+	}
+	age := responseTime.Sub(date)
+	if age < 0 {
+		age = 0
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && seconds > 0 {
+		if ageValue := time.Duration(seconds) * time.Second; ageValue > age {
+			age = ageValue
+		}
+	}
+	if residentTime := time.Since(responseTime); residentTime > 0 {
+		age += residentTime
+	}
+	return age
+}
+
+func freshnessLifetime(resp *http.Response, cacheControl cacheControl) time.Duration {
+	if maxAge, ok := cacheControl.duration("max-age"); ok {
+		return maxAge
+	}
+	expires, err := http.ParseTime(resp.Header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	return expires.Sub(responseDate(resp))
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values(CacheControlHeader) {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if idx := strings.Index(directive, "="); idx >= 0 {
+				name, arg = directive[:idx], strings.Trim(directive[idx+1:], `"`)
+			}
+			cc[strings.ToLower(name)] = arg
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, exist := cc[name]
+	return exist
+}
+
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	value, exist := cc[name]
+	if !exist {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
@@ -0,0 +1,150 @@
+package httpx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestCacheTransport(t *testing.T) {
+	var calls, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set(httpx.CacheControlHeader, "max-age=60")
+		case "/etag":
+			w.Header().Set(httpx.CacheControlHeader, "max-age=0")
+			w.Header().Set(httpx.ETagHeader, `"v1"`)
+			if r.Header.Get(httpx.IfNoneMatchHeader) == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set(httpx.CacheControlHeader, "no-store")
+		case "/age":
+			w.Header().Set(httpx.CacheControlHeader, "max-age=60")
+			w.Header().Set("Date", time.Now().Add(-40*time.Second).UTC().Format(http.TimeFormat))
+			w.Header().Set("Age", "40")
+		case "/private", "/public":
+			w.Header().Set(httpx.CacheControlHeader, "max-age=60")
+			if r.URL.Path == "/public" {
+				w.Header().Set(httpx.CacheControlHeader, "public, max-age=60")
+			}
+		}
+		w.Write([]byte(`{"Data":"cached"}`))
+	}))
+	defer srv.Close()
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			Cache: &httpx.CacheConf{},
+		},
+	})
+	tests := []struct {
+		path          string
+		authorization string
+		expectedCalls int32
+	}{
+		{path: "/fresh", expectedCalls: 1},
+		{path: "/etag", expectedCalls: 2},
+		{path: "/nostore", expectedCalls: 2},
+		{path: "/age", expectedCalls: 1},
+		{path: "/private", authorization: "Bearer a", expectedCalls: 2},
+		{path: "/public", authorization: "Bearer a", expectedCalls: 1},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&calls, 0)
+		for i := 0; i < 2; i++ {
+			resp := &resp{}
+			authorization := func(req *http.Request) error {
+				if test.authorization != "" {
+					req.Header.Set(httpx.AuthorizationHeader, test.authorization)
+				}
+				return nil
+			}
+			if err := httpx.Get(context.TODO(), srv.URL+test.path, resp,
+				httpx.WithClient(client), httpx.WithReqInterceptors(authorization)); err != nil {
+				t.Fatalf("expected nil,got:%v", err)
+			}
+			if resp.Data != "cached" {
+				t.Fatalf("expected:%s,got:%s", "cached", resp.Data)
+			}
+		}
+		if calls != test.expectedCalls {
+			t.Fatalf("path:%s,expected:%d,got:%d", test.path, test.expectedCalls, calls)
+		}
+	}
+	if notModified != 1 {
+		t.Fatalf("expected:%d,got:%d", 1, notModified)
+	}
+}
+
+func TestMemoryCacheStorage(t *testing.T) {
+	storage := httpx.NewMemoryCacheStorage(8)
+	storage.Set("a", []byte("1234"))
+	storage.Set("b", []byte("1234"))
+	storage.Get("a")
+	storage.Set("c", []byte("1234"))
+	if _, ok := storage.Get("b"); ok {
+		t.Fatal("expected b evicted")
+	}
+	if _, ok := storage.Get("a"); !ok {
+		t.Fatal("expected a exist")
+	}
+}
+
+func TestDiskCacheStorage(t *testing.T) {
+	storage, err := httpx.NewDiskCacheStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	storage.Set("a", []byte("1234"))
+	data, ok := storage.Get("a")
+	if !ok || string(data) != "1234" {
+		t.Fatalf("expected:%s,got:%s", "1234", data)
+	}
+	storage.Delete("a")
+	if _, ok := storage.Get("a"); ok {
+		t.Fatal("expected a deleted")
+	}
+}
+
+func TestCacheTransportSkipsLargeResponses(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set(httpx.CacheControlHeader, "max-age=60")
+		w.Header().Set(httpx.ETagHeader, `"v1"`)
+		if r.URL.Path == "/chunked" {
+			w.Write([]byte(`{"Data":`))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(`"chunked"}`))
+			return
+		}
+		w.Write([]byte(`{"Data":"larger than max entry bytes"}`))
+	}))
+	defer srv.Close()
+	maxEntryBytes := int64(16)
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			Cache: &httpx.CacheConf{MaxEntryBytes: &maxEntryBytes},
+		},
+	})
+	for _, path := range []string{"/large", "/chunked"} {
+		atomic.StoreInt32(&calls, 0)
+		for i := 0; i < 2; i++ {
+			if err := httpx.Get(context.TODO(), srv.URL+path, &resp{}, httpx.WithClient(client)); err != nil {
+				t.Fatalf("expected:%v,got:%v", nil, err)
+			}
+		}
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Fatalf("path:%s,expected:%d,got:%d", path, 2, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package httpx
 
 // consts
 const (
-	ContentTypeHeader = "Content-Type"
-	ContentTypeJSON   = "application/json"
+	ContentTypeHeader   = "Content-Type"
+	ContentTypeJSON     = "application/json"
+	AuthorizationHeader = "Authorization"
 )
@@ -0,0 +1,168 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/sync/singleflight"
+)
+
+// consts
+const (
+	// ProxyFromEnvironment 使用HTTP_PROXY/HTTPS_PROXY/NO_PROXY环境变量
+	ProxyFromEnvironment = "env"
+	unixAddrPrefix       = "unix://"
+)
+
+// makeProxy proxy支持http、https及socks5协议,noProxy规则同NO_PROXY环境变量
+func makeProxy(proxy, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return nil, nil
+	}
+	if proxy == ProxyFromEnvironment {
+		return http.ProxyFromEnvironment, nil
+	}
+	if _, err := url.Parse(proxy); err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxy,
+		HTTPSProxy: proxy,
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// vars
+var (
+	DefaultDNSLookupTimeout = 5 * time.Second
+)
+
+type dnsCacheEntry struct {
+	addrs    []string
+	expireAt time.Time
+}
+
+type dnsCache struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+	entries  map[string]*dnsCacheEntry
+	group    singleflight.Group
+	sync.Mutex
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		entries:  make(map[string]*dnsCacheEntry),
+	}
+}
+
+// lookup 解析失败时返回过期的缓存结果,
+// 解析与发起的调用方ctx无关,避免其取消导致同时等待的dial都失败
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.Lock()
+	entry, exist := c.entries[host]
+	c.Unlock()
+	if exist && time.Now().Before(entry.expireAt) {
+		return entry.addrs, nil
+	}
+	ch := c.group.DoChan(host, func() (interface{}, error) {
+		lookupCtx, cancel := context.WithTimeout(context.Background(), DefaultDNSLookupTimeout)
+		defer cancel()
+		addrs, err := c.resolver.LookupHost(lookupCtx, host)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		c.Lock()
+		c.entries[host] = &dnsCacheEntry{addrs: addrs, expireAt: time.Now().Add(c.ttl)}
+		c.Unlock()
+		return addrs, nil
+	})
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, errorsx.Trace(ctx.Err())
+	case result = <-ch:
+	}
+	err := result.Err
+	if err != nil {
+		if exist {
+			log.WithField("host", host).
+				WarnContext(ctx, "dns lookup failed, use stale addrs")
+			return entry.addrs, nil
+		}
+		return nil, errorsx.Trace(err)
+	}
+	return result.Val.([]string), nil
+}
+
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// makeDialContext hostOverrides的值可以是ip、ip:port或unix:///path/to/sock
+func makeDialContext(dialer *net.Dialer, hostOverrides map[string]string, cache *dnsCache) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		log.WithField("network", network).
+			WithField("address", address).
+			DebugContext(ctx, "dial")
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		target, exist := hostOverrides[address]
+		if !exist {
+			target, exist = hostOverrides[host]
+		}
+		if exist {
+			if strings.HasPrefix(target, unixAddrPrefix) {
+				conn, err := dialer.DialContext(ctx, "unix", strings.TrimPrefix(target, unixAddrPrefix))
+				if err != nil {
+					return nil, errorsx.Trace(err).
+						WithField("address", address)
+				}
+				return conn, nil
+			}
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				target = net.JoinHostPort(target, port)
+			}
+			conn, err := dialer.DialContext(ctx, network, target)
+			if err != nil {
+				return nil, errorsx.Trace(err).
+					WithField("address", address)
+			}
+			return conn, nil
+		}
+		if cache == nil || net.ParseIP(host) != nil {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			return conn, nil
+		}
+		addrs, err := cache.lookup(ctx, host)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		err = errorsx.New("no addrs resolved")
+		for _, addr := range addrs {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, errorsx.Trace(err).
+			WithField("address", address)
+	}
+}
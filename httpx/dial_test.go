@@ -0,0 +1,83 @@
+package httpx_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestTransportDial(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "httpx.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	unixSrv := &httptest.Server{
+		Listener: listener,
+		Config:   &http.Server{Handler: &srv{normalResp: "unix"}},
+	}
+	unixSrv.Start()
+	defer unixSrv.Close()
+	tcpSrv := httptest.NewServer(&srv{normalResp: "tcp"})
+	defer tcpSrv.Close()
+	proxySrv := httptest.NewServer(&srv{normalResp: "proxy"})
+	defer proxySrv.Close()
+	tcpURL, _ := url.Parse(tcpSrv.URL)
+	proxy := proxySrv.URL
+	noProxy := "direct.test"
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			Proxy:   &proxy,
+			NoProxy: &noProxy,
+			HostOverrides: map[string]string{
+				"daemon.test": "unix://" + sock,
+				"direct.test": tcpURL.Host,
+			},
+		},
+	})
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{url: "http://daemon.test/", expected: "proxy"},
+		{url: "http://direct.test/", expected: "tcp"},
+		{url: "http://other.test/", expected: "proxy"},
+	}
+	for _, test := range tests {
+		resp := &resp{}
+		if err := httpx.Get(context.TODO(), test.url, resp, httpx.WithClient(client)); err != nil {
+			t.Fatalf("url:%s,expected nil,got:%v", test.url, err)
+		}
+		if resp.Data != test.expected {
+			t.Fatalf("url:%s,expected:%s,got:%s", test.url, test.expected, resp.Data)
+		}
+	}
+	dnsCacheTTL := "1m"
+	client = httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			DNSCacheTTL: &dnsCacheTTL,
+			HostOverrides: map[string]string{
+				"daemon.test": "unix://" + sock,
+			},
+		},
+	})
+	resp := &resp{}
+	if err := httpx.Get(context.TODO(), "http://daemon.test/", resp, httpx.WithClient(client)); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if resp.Data != "unix" {
+		t.Fatalf("expected:%s,got:%s", "unix", resp.Data)
+	}
+	if err := httpx.Get(context.TODO(), "http://localhost:"+tcpURL.Port(), resp, httpx.WithClient(client)); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if resp.Data != "tcp" {
+		t.Fatalf("expected:%s,got:%s", "tcp", resp.Data)
+	}
+}
@@ -0,0 +1,330 @@
+package httpx
+
+import (
+	"context"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+// consts
+const (
+	RangeHeader        = "Range"
+	IfRangeHeader      = "If-Range"
+	ContentRangeHeader = "Content-Range"
+	partialFileSuffix  = ".part"
+)
+
+// errs
+var (
+	ErrChecksumMismatch  = errorsx.Std("checksum mismatch")
+	ErrRangeNotSupported = errorsx.Std("range not supported")
+	errWriteFailed       = errorsx.Std("write failed")
+)
+
+// vars
+var (
+	DefaultDownloadMaxResumes = 3
+	downloadBufferSize        = 32 << 10
+)
+
+// ProgressFunc written为已传输字节数,total未知时为-1
+type ProgressFunc func(written, total int64)
+
+// DownloadOptions DownloadOptions
+type DownloadOptions struct {
+	maxResumes int
+	progress   ProgressFunc
+	hash       hash.Hash
+	checksum   string
+}
+
+// DownloadOption DownloadOption
+type DownloadOption func(*DownloadOptions)
+
+// WithMaxResumes 读取中断后最多通过Range续传的次数
+func WithMaxResumes(maxResumes int) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.maxResumes = maxResumes
+	}
+}
+
+// WithProgress WithProgress
+func WithProgress(progress ProgressFunc) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.progress = progress
+	}
+}
+
+// WithChecksum 下载完成后校验内容的十六进制摘要
+func WithChecksum(h hash.Hash, checksum string) DownloadOption {
+	return func(o *DownloadOptions) {
+		o.hash = h
+		o.checksum = strings.ToLower(checksum)
+	}
+}
+
+// Download 流式写入w,读取中断时从已写入的位置续传
+func (r *Request) Download(ctx context.Context, w io.Writer, opts ...DownloadOption) (int64, error) {
+	options := buildDownloadOptions(opts...)
+	written, err := r.download(ctx, w, 0, nil, options)
+	if err != nil {
+		return written, errorsx.Trace(err)
+	}
+	return written, nil
+}
+
+// DownloadFile 先写入file.part,完成并校验后重命名为file,已存在的file.part会被续传
+func (r *Request) DownloadFile(ctx context.Context, file string, opts ...DownloadOption) (int64, error) {
+	options := buildDownloadOptions(opts...)
+	partial := file + partialFileSuffix
+	f, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, errorsx.Trace(err)
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, errorsx.Trace(err)
+	}
+	if offset > 0 && options.hash != nil {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, errorsx.Trace(err)
+		}
+		if _, err := io.Copy(options.hash, f); err != nil {
+			return 0, errorsx.Trace(err)
+		}
+	}
+	reset := func() error {
+		if err := f.Truncate(0); err != nil {
+			return errorsx.Trace(err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return errorsx.Trace(err)
+		}
+		if options.hash != nil {
+			options.hash.Reset()
+		}
+		return nil
+	}
+	written, err := r.download(ctx, f, offset, reset, options)
+	if err != nil {
+		if errorsx.StdIs(err, ErrChecksumMismatch) {
+			os.Remove(partial)
+		}
+		return written, errorsx.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return written, errorsx.Trace(err)
+	}
+	if err := os.Rename(partial, file); err != nil {
+		return written, errorsx.Trace(err)
+	}
+	return written, nil
+}
+
+func buildDownloadOptions(opts ...DownloadOption) *DownloadOptions {
+	options := &DownloadOptions{maxResumes: DefaultDownloadMaxResumes}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// download reset非空时服务端不支持Range或文件已变化可从头重新下载,
+// 续传时带上If-Range,文件变化时服务端返回200而不是拼接新内容
+func (r *Request) download(ctx context.Context, w io.Writer, offset int64, reset func() error, options *DownloadOptions) (int64, error) {
+	written := offset
+	total := int64(-1)
+	validator := ""
+	for resumes := 0; ; resumes++ {
+		r.header.Del(RangeHeader)
+		r.header.Del(IfRangeHeader)
+		if written > 0 {
+			r.header.Set(RangeHeader, "bytes="+strconv.FormatInt(written, 10)+"-")
+			if validator != "" {
+				r.header.Set(IfRangeHeader, validator)
+			}
+		}
+		httpResp, err := r.do(ctx)
+		if err != nil {
+			return written, errorsx.Trace(err)
+		}
+		body := httpResp.Body
+		switch {
+		case httpResp.StatusCode == http.StatusRequestedRangeNotSatisfiable && written > 0:
+			body.Close()
+			size, ok := parseUnsatisfiedRange(httpResp.Header.Get(ContentRangeHeader))
+			if ok && size == written {
+				return written, r.verifyChecksum(options)
+			}
+			if reset == nil {
+				return written, errorsx.Trace(ErrRangeNotSupported).
+					WithField("contentRange", httpResp.Header.Get(ContentRangeHeader))
+			}
+			if err := reset(); err != nil {
+				return written, errorsx.Trace(err)
+			}
+			written = 0
+			continue
+		case httpResp.StatusCode == http.StatusPartialContent && written > 0:
+			start, size, ok := parseContentRange(httpResp.Header.Get(ContentRangeHeader))
+			if !ok || start != written {
+				body.Close()
+				return written, errorsx.Trace(ErrRangeNotSupported).
+					WithField("contentRange", httpResp.Header.Get(ContentRangeHeader))
+			}
+			total = size
+			if v := rangeValidator(httpResp.Header); v != "" {
+				validator = v
+			}
+		case httpResp.StatusCode == http.StatusOK:
+			if written > 0 {
+				if reset == nil {
+					body.Close()
+					return written, errorsx.Trace(ErrRangeNotSupported)
+				}
+				if err := reset(); err != nil {
+					body.Close()
+					return written, errorsx.Trace(err)
+				}
+				written = 0
+			}
+			total = httpResp.ContentLength
+			validator = rangeValidator(httpResp.Header)
+		default:
+			body.Close()
+			return written, errorsx.New("statuscode mismatch").
+				WithField("got statuscode", httpResp.StatusCode)
+		}
+		n, err := copyWithProgress(w, body, written, total, options)
+		body.Close()
+		written += n
+		if err == nil {
+			return written, r.verifyChecksum(options)
+		}
+		if ctx.Err() != nil || resumes >= options.maxResumes || errorsx.StdIs(err, errWriteFailed) {
+			return written, errorsx.Trace(err)
+		}
+		log.WithField("url", r.url).
+			WithField("written", written).
+			WithField("resumes", resumes+1).
+			WithError(err).
+			WarnContext(ctx, "download interrupted, resume")
+	}
+}
+
+func (r *Request) verifyChecksum(options *DownloadOptions) error {
+	if options.hash == nil {
+		return nil
+	}
+	got := hex.EncodeToString(options.hash.Sum(nil))
+	if got != options.checksum {
+		return errorsx.Trace(ErrChecksumMismatch).
+			WithField("expected", options.checksum).
+			WithField("got", got)
+	}
+	return nil
+}
+
+func copyWithProgress(w io.Writer, body io.Reader, written, total int64, options *DownloadOptions) (int64, error) {
+	buf := make([]byte, downloadBufferSize)
+	var n int64
+	for {
+		nr, readErr := body.Read(buf)
+		if nr > 0 {
+			if _, err := w.Write(buf[:nr]); err != nil {
+				return n, errorsx.Trace(errWriteFailed).
+					WithField("err", err.Error())
+			}
+			if options.hash != nil {
+				options.hash.Write(buf[:nr])
+			}
+			n += int64(nr)
+			if options.progress != nil {
+				options.progress(written+n, total)
+			}
+		}
+		if readErr == io.EOF {
+			if total >= 0 && written+n < total {
+				return n, errorsx.Trace(io.ErrUnexpectedEOF)
+			}
+			return n, nil
+		}
+		if readErr != nil {
+			return n, errorsx.Trace(readErr)
+		}
+	}
+}
+
+// rangeValidator If-Range只能使用强ETag,没有时使用Last-Modified
+func rangeValidator(header http.Header) string {
+	if etag := header.Get(ETagHeader); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get(LastModifiedHeader)
+}
+
+// parseUnsatisfiedRange 解析416响应的bytes */size
+func parseUnsatisfiedRange(contentRange string) (int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes */") {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(contentRange, "bytes */"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return size, true
+}
+
+// parseContentRange 解析bytes start-end/size,size未知时为-1
+func parseContentRange(contentRange string) (int64, int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	rangeParts := strings.SplitN(parts[0], "-", 2)
+	start, err := strconv.ParseInt(rangeParts[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if parts[1] == "*" {
+		return start, -1, true
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+type progressReader struct {
+	io.Reader
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+// ProgressReader 用于上传,与Reader或MultipartFile配合时不会缓冲内容
+func ProgressReader(r io.Reader, total int64, progress ProgressFunc) io.Reader {
+	return &progressReader{Reader: r, total: total, progress: progress}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.written += int64(n)
+		r.progress(r.written, r.total)
+	}
+	return n, err
+}
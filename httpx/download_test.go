@@ -0,0 +1,128 @@
+package httpx_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestDownload(t *testing.T) {
+	content := make([]byte, 1<<20)
+	rand.Read(content)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	var interrupted int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(httpx.RangeHeader) == "" && atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:len(content)/2])
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "content", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	buf := bytes.NewBuffer(nil)
+	var lastWritten, lastTotal int64
+	written, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		Download(context.TODO(), buf,
+			httpx.WithChecksum(sha256.New(), checksum),
+			httpx.WithProgress(func(written, total int64) {
+				lastWritten, lastTotal = written, total
+			}))
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if written != int64(len(content)) || !bytes.Equal(buf.Bytes(), content) {
+		t.Fatalf("expected:%d,got:%d", len(content), written)
+	}
+	if lastWritten != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Fatalf("expected progress:%d/%d,got:%d/%d", len(content), len(content), lastWritten, lastTotal)
+	}
+
+	file := filepath.Join(t.TempDir(), "content")
+	if err := ioutil.WriteFile(file+".part", content[:100], 0644); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		DownloadFile(context.TODO(), file, httpx.WithChecksum(sha256.New(), checksum)); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("expected downloaded file equal to content")
+	}
+
+	_, err = httpx.NewRequest(http.MethodGet, srv.URL).
+		Download(context.TODO(), ioutil.Discard, httpx.WithChecksum(sha256.New(), "00"))
+	if !errorsx.StdIs(err, httpx.ErrChecksumMismatch) {
+		t.Fatalf("expected:%v,got:%v", httpx.ErrChecksumMismatch, err)
+	}
+}
+
+func TestDownloadFileChangedBetweenResumes(t *testing.T) {
+	oldContent := bytes.Repeat([]byte("a"), 1<<16)
+	newContent := bytes.Repeat([]byte("b"), 1<<16)
+	var interrupted int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+			w.Header().Set(httpx.ETagHeader, `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(oldContent)))
+			w.Write(oldContent[:len(oldContent)/2])
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set(httpx.ETagHeader, `"v2"`)
+		http.ServeContent(w, r, "content", time.Time{}, bytes.NewReader(newContent))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "content")
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		DownloadFile(context.TODO(), file); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if !bytes.Equal(data, newContent) {
+		t.Fatalf("expected:%d bytes of new content,got:%q", len(newContent), data[:8])
+	}
+}
+
+func TestDownloadFileStalePartial(t *testing.T) {
+	content := []byte("hello world")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "content", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "content")
+	if err := ioutil.WriteFile(file+".part", bytes.Repeat([]byte("x"), 64), 0644); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		DownloadFile(context.TODO(), file); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatalf("expected:%s,got:%s", content, data)
+	}
+}
@@ -3,8 +3,11 @@ package httpx_test
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/wwq-2020/go.common/httpx"
@@ -129,3 +132,104 @@ func TestDelete(t *testing.T) {
 		t.Fatalf("expected:%s,got:%s", normalResp, got.Data)
 	}
 }
+
+func TestRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, _ := ioutil.ReadAll(file)
+		w.Header().Set("X-Query", r.URL.Query().Get("q"))
+		json.NewEncoder(w).Encode(&resp{Data: r.FormValue("field") + string(data)})
+	}))
+	defer srv.Close()
+	got := &resp{}
+	httpResp, err := httpx.NewRequest(http.MethodPost, srv.URL).
+		Query("q", "query").
+		MultipartField("field", "hello").
+		MultipartFile("file", "file.txt", strings.NewReader("world")).
+		Do(context.TODO(), got)
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	if got.Data != "helloworld" {
+		t.Fatalf("expected:%s,got:%s", "helloworld", got.Data)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected:%d,got:%d", http.StatusOK, httpResp.StatusCode)
+	}
+	if query := httpResp.Header.Get("X-Query"); query != "query" {
+		t.Fatalf("expected:%s,got:%s", "query", query)
+	}
+}
+
+func TestRequestStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	httpResp, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		Do(context.TODO(), &resp{})
+	if err == nil {
+		t.Fatalf("expected:%s,got:%v", "status error", err)
+	}
+	if httpResp == nil || httpResp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected:%d,got:%v", http.StatusTooManyRequests, httpResp)
+	}
+	if retryAfter := httpResp.Header.Get("Retry-After"); retryAfter != "3" {
+		t.Fatalf("expected:%s,got:%s", "3", retryAfter)
+	}
+}
+
+func TestRequestEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	got := &resp{Data: "unchanged"}
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL).
+		Do(context.TODO(), got); err == nil {
+		t.Fatalf("expected:%v,got:%v", "decode error", err)
+	}
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL, httpx.WithAllowEmptyBody()).
+		Do(context.TODO(), got); err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	if got.Data != "unchanged" {
+		t.Fatalf("expected:%s,got:%s", "unchanged", got.Data)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set(httpx.RetryAfterHeader, "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(&resp{Data: r.Method})
+	}))
+	defer srv.Close()
+	got := &resp{}
+	if err := httpx.Get(context.TODO(), srv.URL, got); err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected:%d,got:%d", 2, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if err := httpx.Post(context.TODO(), srv.URL, &req{}, got); err == nil {
+		t.Fatalf("expected:err,got:nil")
+	}
+	if calls != 1 {
+		t.Fatalf("expected:%d,got:%d", 1, calls)
+	}
+}
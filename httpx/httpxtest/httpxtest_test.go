@@ -0,0 +1,75 @@
+package httpxtest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/httpx"
+	"github.com/wwq-2020/go.common/httpx/httpxtest"
+)
+
+type resp struct {
+	Data string
+}
+
+func TestTransport(t *testing.T) {
+	transport := httpxtest.NewTransport()
+	transport.On(http.MethodPost, "http://svc.test/a").
+		Body(`{"Data":"req"}`).
+		ReplyJSON(http.StatusOK, &resp{Data: "a"}).
+		Times(2)
+	transport.OnPattern(http.MethodGet, `^http://svc\.test/b`).
+		ReplyError(errorsx.New("boom"))
+	client := transport.Client()
+	for i := 0; i < 2; i++ {
+		got := &resp{}
+		if err := httpx.Post(context.TODO(), "http://svc.test/a", &resp{Data: "req"}, got, httpx.WithClient(client)); err != nil {
+			t.Fatalf("expected nil,got:%v", err)
+		}
+		if got.Data != "a" {
+			t.Fatalf("expected:%s,got:%s", "a", got.Data)
+		}
+	}
+	if err := httpx.Post(context.TODO(), "http://svc.test/a", &resp{Data: "req"}, nil, httpx.WithClient(client)); !errorsx.StdIs(err, httpxtest.ErrNoMatch) {
+		t.Fatalf("expected:%v,got:%v", httpxtest.ErrNoMatch, err)
+	}
+	if err := httpx.Get(context.TODO(), "http://svc.test/b?x=1", nil, httpx.WithClient(client)); err == nil {
+		t.Fatal("expected err,got nil")
+	}
+	transport.AssertExpectations(t)
+}
+
+func TestRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Data":"recorded"}`))
+	}))
+	file := filepath.Join(t.TempDir(), "golden.json")
+	recorder, err := httpxtest.NewRecorder(file, httpxtest.ModeRecord, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	url := srv.URL + "/x"
+	if err := httpx.Get(context.TODO(), url, &resp{}, httpx.WithClient(&http.Client{Transport: recorder})); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	srv.Close()
+
+	recorder, err = httpxtest.NewRecorder(file, httpxtest.ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	resp := &resp{}
+	if err := httpx.Get(context.TODO(), url, resp, httpx.WithClient(&http.Client{Transport: recorder})); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if resp.Data != "recorded" {
+		t.Fatalf("expected:%s,got:%s", "recorded", resp.Data)
+	}
+}
@@ -0,0 +1,210 @@
+package httpxtest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/wwq-2020/go.common/errorsx"
+)
+
+// consts
+const (
+	// RecordEnv 该环境变量非空时Record会请求真实服务并覆盖golden文件
+	RecordEnv = "HTTPXTEST_RECORD"
+)
+
+// Mode Mode
+type Mode int
+
+// modes
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// ModeFromEnv ModeFromEnv
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Interaction 一次请求及其响应
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest RecordedRequest
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+	// Base64 body不是utf8文本时以base64保存
+	Base64 bool `json:"base64,omitempty"`
+}
+
+// RecordedResponse RecordedResponse
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Base64     bool        `json:"base64,omitempty"`
+}
+
+// Recorder 录制模式下转发到rt并记录,回放模式下从golden文件按顺序返回匹配的响应
+type Recorder struct {
+	file         string
+	mode         Mode
+	rt           http.RoundTripper
+	interactions []*Interaction
+	used         []bool
+	sync.Mutex
+}
+
+// NewRecorder 回放模式下golden文件必须存在
+func NewRecorder(file string, mode Mode, rt http.RoundTripper) (*Recorder, error) {
+	r := &Recorder{file: file, mode: mode, rt: rt}
+	if mode == ModeRecord {
+		return r, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	if err := json.Unmarshal(data, &r.interactions); err != nil {
+		return nil, errorsx.Trace(err).WithField("file", file)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Record 返回使用Recorder的client,录制模式下在测试结束时写入golden文件
+func Record(tb testing.TB, file string, rt http.RoundTripper) *http.Client {
+	tb.Helper()
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	r, err := NewRecorder(file, ModeFromEnv(), rt)
+	if err != nil {
+		tb.Fatalf("failed to NewRecorder:%v", err)
+	}
+	tb.Cleanup(func() {
+		if err := r.Save(); err != nil {
+			tb.Errorf("failed to Save:%v", err)
+		}
+	})
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip RoundTrip
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readReqBody(req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	recordedReq := &RecordedRequest{Method: req.Method, URL: req.URL.String()}
+	recordedReq.Body, recordedReq.Base64 = encodeBody(body)
+	if r.mode == ModeReplay {
+		return r.replay(req, recordedReq)
+	}
+	req = req.Clone(req.Context())
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	recordedResp := &RecordedResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+	recordedResp.Body, recordedResp.Base64 = encodeBody(respBody)
+	r.Lock()
+	r.interactions = append(r.interactions, &Interaction{Request: recordedReq, Response: recordedResp})
+	r.Unlock()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recordedReq *RecordedRequest) (*http.Response, error) {
+	r.Lock()
+	defer r.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || *interaction.Request != *recordedReq {
+			continue
+		}
+		r.used[i] = true
+		recordedResp := interaction.Response
+		body, err := decodeBody(recordedResp.Body, recordedResp.Base64)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		return &http.Response{
+			Status:        strconv.Itoa(recordedResp.StatusCode) + " " + http.StatusText(recordedResp.StatusCode),
+			StatusCode:    recordedResp.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recordedResp.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, errorsx.Trace(ErrNoMatch).
+		WithField("method", req.Method).
+		WithField("url", req.URL.String()).
+		WithField("file", r.file)
+}
+
+// Save 仅在录制模式下写入golden文件
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.Lock()
+	defer r.Unlock()
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.file), 0755); err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := ioutil.WriteFile(r.file, data, 0644); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+func encodeBody(body []byte) (string, bool) {
+	if utf8.Valid(body) {
+		return string(body), false
+	}
+	return base64.StdEncoding.EncodeToString(body), true
+}
+
+func decodeBody(body string, isBase64 bool) ([]byte, error) {
+	if !isBase64 {
+		return []byte(body), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return data, nil
+}
@@ -0,0 +1,212 @@
+// Package httpxtest 提供httpx的测试替身:可编程的RoundTripper及录制/回放
+package httpxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/wwq-2020/go.common/errorsx"
+)
+
+// errs
+var (
+	ErrNoMatch = errorsx.Std("no matching mock")
+)
+
+// Mock Mock
+type Mock struct {
+	method     string
+	url        string
+	urlPattern *regexp.Regexp
+	bodyMatch  func([]byte) bool
+	status     int
+	header     http.Header
+	body       []byte
+	err        error
+	times      int
+	calls      int
+	transport  *Transport
+}
+
+// Body 请求body需完全相同
+func (m *Mock) Body(body string) *Mock {
+	return m.BodyMatch(func(data []byte) bool {
+		return string(data) == body
+	})
+}
+
+// BodyMatch BodyMatch
+func (m *Mock) BodyMatch(match func([]byte) bool) *Mock {
+	m.bodyMatch = match
+	return m
+}
+
+// Reply Reply
+func (m *Mock) Reply(status int, body string) *Mock {
+	m.status = status
+	m.body = []byte(body)
+	return m
+}
+
+// ReplyJSON ReplyJSON
+func (m *Mock) ReplyJSON(status int, v interface{}) *Mock {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	m.header.Set("Content-Type", "application/json")
+	m.status = status
+	m.body = data
+	return m
+}
+
+// ReplyHeader 响应头
+func (m *Mock) ReplyHeader(key, value string) *Mock {
+	m.header.Add(key, value)
+	return m
+}
+
+// ReplyError RoundTrip直接返回err
+func (m *Mock) ReplyError(err error) *Mock {
+	m.err = err
+	return m
+}
+
+// Times 期望被调用的次数,超过后不再匹配,AssertExpectations会检查
+func (m *Mock) Times(times int) *Mock {
+	m.times = times
+	return m
+}
+
+// Calls Calls
+func (m *Mock) Calls() int {
+	m.transport.Lock()
+	defer m.transport.Unlock()
+	return m.calls
+}
+
+func (m *Mock) match(req *http.Request, body []byte) bool {
+	if m.times > 0 && m.calls >= m.times {
+		return false
+	}
+	if m.method != "" && m.method != req.Method {
+		return false
+	}
+	if m.urlPattern != nil && !m.urlPattern.MatchString(req.URL.String()) {
+		return false
+	}
+	if m.urlPattern == nil && m.url != "" && m.url != req.URL.String() {
+		return false
+	}
+	return m.bodyMatch == nil || m.bodyMatch(body)
+}
+
+func (m *Mock) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(m.status) + " " + http.StatusText(m.status),
+		StatusCode:    m.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        m.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(m.body)),
+		ContentLength: int64(len(m.body)),
+		Request:       req,
+	}
+}
+
+// Transport 按注册顺序匹配Mock的RoundTripper
+type Transport struct {
+	mocks []*Mock
+	sync.Mutex
+}
+
+// NewTransport NewTransport
+func NewTransport() *Transport {
+	return &Transport{}
+}
+
+// On method为空时匹配任意方法,url需与请求URL完全相同,为空时匹配任意URL
+func (t *Transport) On(method, url string) *Mock {
+	return t.add(&Mock{method: method, url: url})
+}
+
+// OnPattern urlPattern为匹配完整URL的正则
+func (t *Transport) OnPattern(method, urlPattern string) *Mock {
+	return t.add(&Mock{method: method, urlPattern: regexp.MustCompile(urlPattern)})
+}
+
+func (t *Transport) add(m *Mock) *Mock {
+	m.status = http.StatusOK
+	m.header = make(http.Header)
+	m.transport = t
+	t.Lock()
+	defer t.Unlock()
+	t.mocks = append(t.mocks, m)
+	return m
+}
+
+// Client Client
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RoundTrip RoundTrip
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readReqBody(req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	t.Lock()
+	defer t.Unlock()
+	for _, m := range t.mocks {
+		if !m.match(req, body) {
+			continue
+		}
+		m.calls++
+		if m.err != nil {
+			return nil, m.err
+		}
+		return m.response(req), nil
+	}
+	return nil, errorsx.Trace(ErrNoMatch).
+		WithField("method", req.Method).
+		WithField("url", req.URL.String())
+}
+
+// AssertExpectations 检查设置了Times的Mock被调用的次数
+func (t *Transport) AssertExpectations(tb testing.TB) {
+	tb.Helper()
+	t.Lock()
+	defer t.Unlock()
+	for _, m := range t.mocks {
+		if m.times > 0 && m.calls != m.times {
+			tb.Errorf("mock %s %s%s expected calls:%d,got:%d", m.method, m.url, patternString(m.urlPattern), m.times, m.calls)
+		}
+	}
+}
+
+func patternString(pattern *regexp.Regexp) string {
+	if pattern == nil {
+		return ""
+	}
+	return pattern.String()
+}
+
+func readReqBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return body, nil
+}
@@ -0,0 +1,58 @@
+package httpx
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clientRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "httpx_client_request_duration_seconds",
+		Help: "Duration of outgoing requests per host, method and status code.",
+	}, []string{"host", "method", "code"})
+	clientTraceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "httpx_client_trace_duration_seconds",
+		Help: "Duration of outgoing request phases per host, dns, connect, tls, ttfb and total.",
+	}, []string{"host", "phase"})
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpx_cache_requests_total",
+		Help: "The total number of cacheable requests per host and result, hit, miss, stale or revalidated.",
+	}, []string{"host", "result"})
+	rateLimitRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpx_ratelimit_rejected_total",
+		Help: "The total number of requests failed waiting for a rate limit token per bucket.",
+	}, []string{"bucket"})
+	rateLimitCurrent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "httpx_ratelimit_current_rate",
+		Help: "The current requests per second of an adaptively slowed down rate limit bucket.",
+	}, []string{"bucket"})
+	circuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "httpx_circuit_breaker_state",
+		Help: "Circuit breaker state per host, 0 closed, 1 half-open, 2 open.",
+	}, []string{"host"})
+	circuitBreakerRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpx_circuit_breaker_rejected_total",
+		Help: "The total number of requests rejected by an open circuit breaker.",
+	}, []string{"host"})
+	bulkheadInflight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "httpx_bulkhead_inflight",
+		Help: "The number of in-flight requests per host.",
+	}, []string{"host"})
+	bulkheadRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "httpx_bulkhead_rejected_total",
+		Help: "The total number of requests rejected by a full bulkhead.",
+	}, []string{"host"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		clientRequestDuration,
+		clientTraceDuration,
+		cacheRequests,
+		rateLimitRejected,
+		rateLimitCurrent,
+		circuitBreakerState,
+		circuitBreakerRejected,
+		bulkheadInflight,
+		bulkheadRejected,
+	)
+}
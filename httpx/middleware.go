@@ -0,0 +1,189 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/stack"
+	"github.com/wwq-2020/go.common/tracing"
+)
+
+// Middleware Middleware
+type Middleware func(http.Handler) http.Handler
+
+// ChainMiddleware ChainMiddleware
+func ChainMiddleware(middlewares ...Middleware) Middleware {
+	return func(handler http.Handler) http.Handler {
+		chainedHandler := handler
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			chainedHandler = middlewares[i](chainedHandler)
+		}
+		return chainedHandler
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	// buffer 非nil时记录响应body,用于日志
+	buffer     *bytes.Buffer
+	statusCode int
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	rw.ResponseWriter.WriteHeader(statusCode)
+	rw.statusCode = statusCode
+}
+
+func (rw *responseWriter) Write(data []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(data)
+	if rw.buffer != nil {
+		rw.buffer.Write(data[:n])
+	}
+	if err != nil {
+		return n, errorsx.Trace(err)
+	}
+	return n, nil
+}
+
+// Flush 流式响应需要
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack websocket需要
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errorsx.New("response writer does not implement http.Hijacker")
+	}
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// TraceOptions TraceMiddlewareEx的选项,零值即TraceMiddleware的行为
+type TraceOptions struct {
+	// Timeout 大于0时为请求ctx设置超时
+	Timeout time.Duration
+	// LogBody 记录请求和响应body,会缓冲整个body,流式接口不要开启
+	LogBody bool
+	// Context 开始span后调用,可注入metadata及日志字段,返回的ctx用于后续处理
+	Context func(ctx context.Context, req *http.Request) context.Context
+	// Fields 只记录在收发日志和span上的字段,不进入ctx
+	Fields func(ctx context.Context) stack.Fields
+	// FinishFields 处理完成时根据响应头追加的字段
+	FinishFields func(header http.Header) stack.Fields
+}
+
+// TraceMiddleware TraceMiddleware
+func TraceMiddleware(next http.Handler) http.Handler {
+	return TraceMiddlewareEx(TraceOptions{})(next)
+}
+
+// TraceMiddlewareEx httpx.Server和rpc共用的trace中间件,开启span并记录收发日志
+func TraceMiddlewareEx(opts TraceOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			span, ctx := tracing.HTTPServerStartSpan(ctx, "serve", req, w)
+			if opts.Context != nil {
+				ctx = opts.Context(ctx, req)
+			}
+			rw := &responseWriter{ResponseWriter: w}
+			fields := log.FieldsFromContext(ctx).
+				Set("httpmethod", req.Method).
+				Set("path", req.URL.Path)
+			if opts.Fields != nil {
+				fields = fields.Merge(opts.Fields(ctx))
+			}
+			var err error
+			defer span.FinishWithFields(&err, fields)
+			if opts.LogBody {
+				var reqData []byte
+				reqData, req.Body, err = DrainBody(req.Body)
+				if err != nil {
+					fields.Set("httpStatusCode", http.StatusInternalServerError)
+					log.WithFields(fields).
+						ErrorContext(ctx, err)
+					rw.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				rw.buffer = bytes.NewBuffer(nil)
+				fields.Set("reqData", string(reqData))
+			}
+			start := time.Now()
+			fields.Set("handleStart", start.Format("2006-01-02 15:04:05"))
+			log.WithFields(fields).
+				InfoContext(ctx, "recv req")
+			req = req.WithContext(ctx)
+			if next != nil {
+				next.ServeHTTP(rw, req)
+			}
+			if rw.statusCode == 0 {
+				rw.statusCode = http.StatusOK
+			}
+			end := time.Now()
+			finish := stack.New().
+				Set("httpStatusCode", rw.statusCode).
+				Set("elapsed", end.Sub(start).Milliseconds()).
+				Set("handleEnd", end.Format("2006-01-02 15:04:05"))
+			if rw.buffer != nil {
+				finish.Set("respData", rw.buffer.String())
+			}
+			if opts.FinishFields != nil {
+				finish = finish.Merge(opts.FinishFields(rw.Header()))
+			}
+			for k, v := range finish.KVs() {
+				fields.Set(k, v)
+			}
+			log.WithFields(finish).
+				InfoContext(ctx, "finish req")
+		})
+	}
+}
+
+// RecoveryMiddleware RecoveryMiddleware
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		defer func() {
+			ctx := req.Context()
+			if e := recover(); e != nil {
+				if e == http.ErrAbortHandler {
+					panic(http.ErrAbortHandler)
+				}
+				var err error
+				switch v := e.(type) {
+				case error:
+					err = v
+				default:
+					err = fmt.Errorf("%+v", v)
+				}
+				stack := stack.Callers(stack.StdFilter)
+				log.WithField("stack", stack).
+					ErrorContext(ctx, err)
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}()
+		if next != nil {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// vars
+var (
+	DefaultTokenType         = "Bearer"
+	DefaultTokenExpiryLeeway = 30 * time.Second
+	DefaultTokenFetchTimeout = 10 * time.Second
+)
+
+// ClientCredentialsTokenSource依赖defaultOptions,需在init中注册以避免初始化循环
+func init() {
+	RegisterRoundTripperMiddleware(OAuth2MiddlewareName, func(c *TransportConf) RoundTripperMiddleware {
+		if c.OAuth2 == nil {
+			log.Error(errorsx.New("oauth2 middleware without oauth2 conf"))
+			return func(rt http.RoundTripper) http.RoundTripper {
+				return rt
+			}
+		}
+		return OAuth2Middleware(ClientCredentialsTokenSource(c.OAuth2))
+	})
+}
+
+// Token Token
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	// Expiry 为零值时表示不过期
+	Expiry time.Time `json:"-"`
+}
+
+// Authorization Authorization头的值
+func (t *Token) Authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, DefaultTokenType) {
+		tokenType = DefaultTokenType
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+func (t *Token) valid(leeway time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(leeway).Before(t.Expiry)
+}
+
+// TokenSource TokenSource
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc TokenSourceFunc
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token Token
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// StaticTokenSource 始终返回同一个bearer token
+func StaticTokenSource(accessToken string) TokenSource {
+	token := &Token{AccessToken: accessToken, TokenType: DefaultTokenType}
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return token, nil
+	})
+}
+
+type cachedTokenSource struct {
+	src    TokenSource
+	leeway time.Duration
+	token  *Token
+	group  singleflight.Group
+	sync.Mutex
+}
+
+// CachedTokenSource 缓存token直到过期前leeway,并发刷新时只请求一次
+func CachedTokenSource(src TokenSource, leeway time.Duration) TokenSource {
+	return &cachedTokenSource{src: src, leeway: leeway}
+}
+
+func (s *cachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.Lock()
+	token := s.token
+	s.Unlock()
+	if token.valid(s.leeway) {
+		return token, nil
+	}
+	// 获取token与发起的调用方ctx无关,避免其取消导致同时等待的调用方都失败
+	ch := s.group.DoChan("token", func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), DefaultTokenFetchTimeout)
+		defer cancel()
+		token, err := s.src.Token(fetchCtx)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		s.Lock()
+		s.token = token
+		s.Unlock()
+		return token, nil
+	})
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, errorsx.Trace(ctx.Err())
+	case result = <-ch:
+	}
+	if result.Err != nil {
+		return nil, errorsx.Trace(result.Err)
+	}
+	return result.Val.(*Token), nil
+}
+
+// invalidator TokenSource可实现Invalidate,在401时丢弃被拒绝的token
+type invalidator interface {
+	Invalidate(token *Token)
+}
+
+// Invalidate 仅当缓存的仍是被拒绝的token时才丢弃,避免并发401重复刷新
+func (s *cachedTokenSource) Invalidate(token *Token) {
+	s.Lock()
+	defer s.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+// ClientCredentialsConf ClientCredentialsConf
+type ClientCredentialsConf struct {
+	TokenURL     *string  `toml:"token_url" yaml:"token_url" json:"token_url"`
+	ClientID     *string  `toml:"client_id" yaml:"client_id" json:"client_id"`
+	ClientSecret *string  `toml:"client_secret" yaml:"client_secret" json:"client_secret" secret:"true"`
+	Scopes       []string `toml:"scopes" yaml:"scopes" json:"scopes" nullable:"true"`
+}
+
+// ClientCredentialsTokenSource client credentials模式获取token,结果已缓存
+func ClientCredentialsTokenSource(conf *ClientCredentialsConf, opts ...Option) TokenSource {
+	src := TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(conf.Scopes) != 0 {
+			form.Set("scope", strings.Join(conf.Scopes, " "))
+		}
+		token := &Token{}
+		_, err := NewRequest(http.MethodPost, *conf.TokenURL, opts...).
+			Header(AuthorizationHeader, basicAuthorization(*conf.ClientID, *conf.ClientSecret)).
+			Form(form).
+			Do(ctx, token)
+		if err != nil {
+			return nil, errorsx.Trace(err).
+				WithField("tokenURL", *conf.TokenURL)
+		}
+		if token.AccessToken == "" {
+			return nil, errorsx.New("empty access token").
+				WithField("tokenURL", *conf.TokenURL)
+		}
+		if token.ExpiresIn > 0 {
+			token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		}
+		return token, nil
+	})
+	return CachedTokenSource(src, DefaultTokenExpiryLeeway)
+}
+
+func basicAuthorization(username, password string) string {
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(url.QueryEscape(username), url.QueryEscape(password))
+	return req.Header.Get(AuthorizationHeader)
+}
+
+// OAuth2Middleware 为请求附加token,收到401时丢弃缓存的token并用新token重试一次
+func OAuth2Middleware(src TokenSource) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			token, err := src.Token(ctx)
+			if err != nil {
+				closeBody(req.Body)
+				return nil, errorsx.Trace(err)
+			}
+			authReq := req.Clone(ctx)
+			authReq.Header.Set(AuthorizationHeader, token.Authorization())
+			resp, err := rt.RoundTrip(authReq)
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			if resp.StatusCode != http.StatusUnauthorized {
+				return resp, nil
+			}
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				return resp, nil
+			}
+			if invalidator, ok := src.(invalidator); ok {
+				invalidator.Invalidate(token)
+			}
+			rejected := token
+			token, err = src.Token(ctx)
+			// 未实现invalidator的TokenSource返回同一个token时不再重试
+			if err != nil || token.AccessToken == rejected.AccessToken {
+				return resp, nil
+			}
+			retryReq := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return resp, nil
+				}
+				retryReq.Body = body
+			}
+			resp.Body.Close()
+			retryReq.Header.Set(AuthorizationHeader, token.Authorization())
+			resp, err = rt.RoundTrip(retryReq)
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			return resp, nil
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package httpx_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestOAuth2Middleware(t *testing.T) {
+	var issued int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != "id" || clientSecret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token%d", n),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenSrv.Close()
+	var revoked int32
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&revoked) == 1 && r.Header.Get(httpx.AuthorizationHeader) == "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(&resp{Data: r.Header.Get(httpx.AuthorizationHeader)})
+	}))
+	defer apiSrv.Close()
+	tokenURL, clientID, clientSecret := tokenSrv.URL, "id", "secret"
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			OAuth2: &httpx.ClientCredentialsConf{
+				TokenURL:     &tokenURL,
+				ClientID:     &clientID,
+				ClientSecret: &clientSecret,
+			},
+		},
+	})
+	get := func() (string, error) {
+		resp := &resp{}
+		if err := httpx.Get(context.TODO(), apiSrv.URL, resp, httpx.WithClient(client)); err != nil {
+			return "", err
+		}
+		return resp.Data, nil
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get(); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if issued := atomic.LoadInt32(&issued); issued != 1 {
+		t.Fatalf("expected:%d,got:%d", 1, issued)
+	}
+	atomic.StoreInt32(&revoked, 1)
+	data, err := get()
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if data != "Bearer token2" {
+		t.Fatalf("expected:%s,got:%s", "Bearer token2", data)
+	}
+}
+
+type rotatingTokenSource struct {
+	n int32
+}
+
+func (s *rotatingTokenSource) Token(ctx context.Context) (*httpx.Token, error) {
+	return &httpx.Token{
+		AccessToken: fmt.Sprintf("custom%d", atomic.LoadInt32(&s.n)),
+		TokenType:   "Bearer",
+	}, nil
+}
+
+func (s *rotatingTokenSource) Invalidate(token *httpx.Token) {
+	atomic.AddInt32(&s.n, 1)
+}
+
+func TestOAuth2MiddlewareCustomTokenSource(t *testing.T) {
+	apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(httpx.AuthorizationHeader) == "Bearer custom0" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(&resp{Data: r.Header.Get(httpx.AuthorizationHeader)})
+	}))
+	defer apiSrv.Close()
+	client := &http.Client{
+		Transport: httpx.OAuth2Middleware(&rotatingTokenSource{})(http.DefaultTransport),
+	}
+	got := &resp{}
+	if err := httpx.Get(context.TODO(), apiSrv.URL, got, httpx.WithClient(client)); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if got.Data != "Bearer custom1" {
+		t.Fatalf("expected:%s,got:%s", "Bearer custom1", got.Data)
+	}
+}
+
+func TestCachedTokenSourceCallerCanceled(t *testing.T) {
+	release := make(chan struct{})
+	src := httpx.CachedTokenSource(httpx.TokenSourceFunc(func(ctx context.Context) (*httpx.Token, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &httpx.Token{AccessToken: "token"}, nil
+	}), 0)
+	ctx, cancel := context.WithCancel(context.TODO())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := src.Token(ctx)
+		firstErr <- err
+	}()
+	secondToken := make(chan *httpx.Token, 1)
+	secondErr := make(chan error, 1)
+	go func() {
+		token, err := src.Token(context.TODO())
+		secondToken <- token
+		secondErr <- err
+	}()
+	cancel()
+	if err := <-firstErr; err == nil {
+		t.Fatalf("expected:%v,got:%v", context.Canceled, err)
+	}
+	close(release)
+	if err := <-secondErr; err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if token := <-secondToken; token.AccessToken != "token" {
+		t.Fatalf("expected:%s,got:%s", "token", token.AccessToken)
+	}
+}
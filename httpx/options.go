@@ -13,6 +13,7 @@ type Options struct {
 	client          *http.Client
 	reqInterceptor  ReqInterceptor
 	respInterceptor RespInterceptor
+	allowEmptyBody  bool
 }
 
 // TracingOptions TracingOptions
@@ -59,3 +60,10 @@ func WithRespInterceptors(respInterceptors ...RespInterceptor) Option {
 		o.respInterceptor = ChainedRespInterceptor(respInterceptors...)
 	}
 }
+
+// WithAllowEmptyBody 响应body为空时不做解码,resp保持原值
+func WithAllowEmptyBody() Option {
+	return func(o *Options) {
+		o.allowEmptyBody = true
+	}
+}
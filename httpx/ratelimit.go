@@ -0,0 +1,240 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"golang.org/x/time/rate"
+)
+
+// errs
+var (
+	ErrRateLimited = errorsx.Std("rate limited")
+)
+
+// vars
+var (
+	DefaultRateLimitRate  = 100.0
+	DefaultRateLimitBurst = 10
+	// minRateLimitFactor 429降速后的速率下限为配置速率的1/16
+	minRateLimitFactor = 1.0 / 16
+	// rateLimitRecoverFactor 每次成功请求后速率的恢复倍数
+	rateLimitRecoverFactor = 1.1
+)
+
+// RateLimitRule RateLimitRule
+type RateLimitRule struct {
+	// Host 精确匹配host
+	Host *string `toml:"host" yaml:"host" json:"host"`
+	// Pattern 匹配host+path的正则,Host为空时生效
+	Pattern *string `toml:"pattern" yaml:"pattern" json:"pattern"`
+	// Rate 每秒请求数
+	Rate  *float64 `toml:"rate" yaml:"rate" json:"rate"`
+	Burst *int     `toml:"burst" yaml:"burst" json:"burst"`
+}
+
+func (r *RateLimitRule) fill() {
+	if r.Rate == nil || *r.Rate <= 0 {
+		r.Rate = &DefaultRateLimitRate
+	}
+	if r.Burst == nil || *r.Burst <= 0 {
+		r.Burst = &DefaultRateLimitBurst
+	}
+}
+
+// RateLimitConf 按顺序匹配Rules,同一规则共享令牌桶,未匹配的请求按Default为每个host建桶
+type RateLimitConf struct {
+	Rules []*RateLimitRule `toml:"rules" yaml:"rules" json:"rules"`
+	// Default 为空时未匹配的请求不限流
+	Default *RateLimitRule `toml:"default" yaml:"default" json:"default" nullable:"true"`
+}
+
+type rateLimitBucket struct {
+	name         string
+	limiter      *rate.Limiter
+	limit        rate.Limit
+	blockedUntil time.Time
+	sync.Mutex
+}
+
+func newRateLimitBucket(name string, rule *RateLimitRule) *rateLimitBucket {
+	limit := rate.Limit(*rule.Rate)
+	return &rateLimitBucket{
+		name:    name,
+		limiter: rate.NewLimiter(limit, *rule.Burst),
+		limit:   limit,
+	}
+}
+
+// wait 等待令牌,无法在ctx的deadline之前拿到令牌时立即失败
+func (b *rateLimitBucket) wait(ctx context.Context) error {
+	b.Lock()
+	blocked := time.Until(b.blockedUntil)
+	b.Unlock()
+	if blocked > 0 {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < blocked {
+			return errorsx.Trace(ErrRateLimited)
+		}
+		if err := sleepContext(ctx, blocked); err != nil {
+			return errorsx.Trace(err)
+		}
+	}
+	if err := b.limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return errorsx.Trace(ctx.Err())
+		}
+		return errorsx.Trace(ErrRateLimited)
+	}
+	return nil
+}
+
+// slowdown 收到429时暂停到Retry-After之后并把速率减半
+func (b *rateLimitBucket) slowdown(retryAfter time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	if until := time.Now().Add(retryAfter); until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	limit := b.limiter.Limit() / 2
+	if min := b.limit * rate.Limit(minRateLimitFactor); limit < min {
+		limit = min
+	}
+	b.limiter.SetLimit(limit)
+	rateLimitCurrent.WithLabelValues(b.name).Set(float64(limit))
+	log.WithField("bucket", b.name).
+		WithField("retryAfter", retryAfter.String()).
+		WithField("limit", float64(limit)).
+		Warn("rate limit slowdown")
+}
+
+// recover 成功请求后逐步恢复到配置速率
+func (b *rateLimitBucket) recover() {
+	b.Lock()
+	defer b.Unlock()
+	limit := b.limiter.Limit()
+	if limit >= b.limit {
+		return
+	}
+	limit = limit * rate.Limit(rateLimitRecoverFactor)
+	if limit > b.limit {
+		limit = b.limit
+	}
+	b.limiter.SetLimit(limit)
+	rateLimitCurrent.WithLabelValues(b.name).Set(float64(limit))
+}
+
+type rateLimitMatcher struct {
+	rule    *RateLimitRule
+	pattern *regexp.Regexp
+	bucket  *rateLimitBucket
+}
+
+func (m *rateLimitMatcher) match(req *http.Request) bool {
+	if m.rule.Host != nil && *m.rule.Host != "" {
+		return *m.rule.Host == req.URL.Host
+	}
+	return m.pattern.MatchString(req.URL.Host + req.URL.Path)
+}
+
+type rateLimitTransport struct {
+	rt          http.RoundTripper
+	matchers    []*rateLimitMatcher
+	defaultRule *RateLimitRule
+	hostBuckets map[string]*rateLimitBucket
+	sync.Mutex
+}
+
+// RateLimitTransport 客户端令牌桶限流,429时按Retry-After自适应降速
+func RateLimitTransport(rt http.RoundTripper, conf *RateLimitConf) http.RoundTripper {
+	if conf == nil {
+		conf = &RateLimitConf{}
+	}
+	t := &rateLimitTransport{
+		rt:          rt,
+		defaultRule: conf.Default,
+		hostBuckets: make(map[string]*rateLimitBucket),
+	}
+	if t.defaultRule != nil {
+		t.defaultRule.fill()
+	}
+	for _, rule := range conf.Rules {
+		rule.fill()
+		matcher := &rateLimitMatcher{rule: rule}
+		name := ""
+		switch {
+		case rule.Host != nil && *rule.Host != "":
+			name = *rule.Host
+		case rule.Pattern != nil && *rule.Pattern != "":
+			pattern, err := regexp.Compile(*rule.Pattern)
+			if err != nil {
+				log.WithField("pattern", *rule.Pattern).
+					Error(errorsx.Trace(err))
+				continue
+			}
+			matcher.pattern = pattern
+			name = *rule.Pattern
+		default:
+			log.Error(errorsx.New("rate limit rule without host or pattern"))
+			continue
+		}
+		matcher.bucket = newRateLimitBucket(name, rule)
+		t.matchers = append(t.matchers, matcher)
+	}
+	return t
+}
+
+// RateLimitMiddleware RateLimitMiddleware
+func RateLimitMiddleware(conf *RateLimitConf) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return RateLimitTransport(rt, conf)
+	}
+}
+
+func (t *rateLimitTransport) bucket(req *http.Request) *rateLimitBucket {
+	for _, matcher := range t.matchers {
+		if matcher.match(req) {
+			return matcher.bucket
+		}
+	}
+	if t.defaultRule == nil {
+		return nil
+	}
+	host := req.URL.Host
+	t.Lock()
+	defer t.Unlock()
+	bucket, exist := t.hostBuckets[host]
+	if !exist {
+		bucket = newRateLimitBucket(host, t.defaultRule)
+		t.hostBuckets[host] = bucket
+	}
+	return bucket
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bucket := t.bucket(req)
+	if bucket == nil {
+		return t.rt.RoundTrip(req)
+	}
+	if err := bucket.wait(req.Context()); err != nil {
+		rateLimitRejected.WithLabelValues(bucket.name).Inc()
+		closeBody(req.Body)
+		return nil, errorsx.Trace(err).
+			WithField("bucket", bucket.name)
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := parseRetryAfter(resp.Header.Get(RetryAfterHeader))
+		bucket.slowdown(retryAfter)
+		return resp, nil
+	}
+	bucket.recover()
+	return resp, nil
+}
@@ -0,0 +1,61 @@
+package httpx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fast/throttled" {
+			w.Header().Set(httpx.RetryAfterHeader, "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+	srvURL, _ := url.Parse(srv.URL)
+	maxRetry := 0
+	slowRate, fastRate := 1.0, 1000.0
+	burst := 1
+	pattern := `/fast`
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			MaxRetry: &maxRetry,
+			RateLimit: &httpx.RateLimitConf{
+				Rules: []*httpx.RateLimitRule{
+					{Pattern: &pattern, Rate: &fastRate, Burst: &burst},
+					{Host: &srvURL.Host, Rate: &slowRate, Burst: &burst},
+				},
+			},
+		},
+	})
+	get := func(path string) error {
+		ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+		defer cancel()
+		_, err := httpx.NewRequest(http.MethodGet, srv.URL+path, httpx.WithClient(client)).
+			Do(ctx, nil)
+		return err
+	}
+	for i := 0; i < 3; i++ {
+		if err := get("/fast"); err != nil {
+			t.Fatalf("expected:%v,got:%v", nil, err)
+		}
+	}
+	if err := get("/slow"); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if err := get("/slow"); !errorsx.StdIs(err, httpx.ErrRateLimited) {
+		t.Fatalf("expected:%v,got:%v", httpx.ErrRateLimited, err)
+	}
+	get("/fast/throttled")
+	if err := get("/fast"); !errorsx.StdIs(err, httpx.ErrRateLimited) {
+		t.Fatalf("expected:%v,got:%v", httpx.ErrRateLimited, err)
+	}
+}
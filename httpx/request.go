@@ -0,0 +1,286 @@
+package httpx
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/syncx"
+)
+
+// consts
+const (
+	ContentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// Response Response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Value 解码后的响应,即Do传入的resp
+	Value interface{}
+	// Body 仅Stream时有效,需调用方关闭
+	Body io.ReadCloser
+}
+
+type multipartPart struct {
+	field    string
+	filename string
+	value    string
+	content  io.Reader
+}
+
+// Request Request
+type Request struct {
+	method      string
+	url         string
+	query       url.Values
+	header      http.Header
+	body        interface{}
+	hasBody     bool
+	reader      io.Reader
+	contentType string
+	form        url.Values
+	parts       []*multipartPart
+	options     Options
+}
+
+// NewRequest NewRequest
+func NewRequest(method, rawURL string, opts ...Option) *Request {
+	options := defaultOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return &Request{
+		method:  method,
+		url:     rawURL,
+		query:   make(url.Values),
+		header:  make(http.Header),
+		options: options,
+	}
+}
+
+// Query Query
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Header Header
+func (r *Request) Header(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// Codec Codec
+func (r *Request) Codec(codec Codec) *Request {
+	r.options.codec = codec
+	return r
+}
+
+// Body body会被codec编码
+func (r *Request) Body(body interface{}) *Request {
+	r.body = body
+	r.hasBody = body != nil
+	return r
+}
+
+// Reader 原样发送body,不做缓冲
+func (r *Request) Reader(body io.Reader, contentType string) *Request {
+	r.reader = body
+	r.contentType = contentType
+	return r
+}
+
+// Form Form
+func (r *Request) Form(form url.Values) *Request {
+	r.form = form
+	return r
+}
+
+// MultipartField MultipartField
+func (r *Request) MultipartField(field, value string) *Request {
+	r.parts = append(r.parts, &multipartPart{field: field, value: value})
+	return r
+}
+
+// MultipartFile 文件内容在发送时流式写入,不做缓冲
+func (r *Request) MultipartFile(field, filename string, content io.Reader) *Request {
+	r.parts = append(r.parts, &multipartPart{field: field, filename: filename, content: content})
+	return r
+}
+
+// Do 发送请求并把响应解码到resp,设置WithAllowEmptyBody时body为空不做解码;
+// respInterceptor返回错误(如非200)时同时返回带StatusCode和Header的Response
+func (r *Request) Do(ctx context.Context, resp interface{}) (*Response, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Second)
+		defer cancel()
+	}
+	httpResp, err := r.do(ctx)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	response := &Response{
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+	}
+	respData, respBody, err := DrainBody(httpResp.Body)
+	if err != nil {
+		return response, errorsx.Trace(err)
+	}
+	httpResp.Body = respBody
+	if r.options.respInterceptor != nil {
+		if err := r.options.respInterceptor(httpResp); err != nil {
+			return response, errorsx.Trace(err)
+		}
+	}
+	if resp != nil && !(r.options.allowEmptyBody && len(respData) == 0) {
+		if err := r.options.codec.Decode(respData, resp); err != nil {
+			return response, errorsx.Trace(err)
+		}
+	}
+	response.Value = resp
+	return response, nil
+}
+
+// Stream 发送请求,响应body不做读取,由调用方读取并关闭;
+// respInterceptor返回错误时body已关闭,Response只带StatusCode和Header
+func (r *Request) Stream(ctx context.Context) (*Response, error) {
+	httpResp, err := r.do(ctx)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	if r.options.respInterceptor != nil {
+		if err := r.options.respInterceptor(httpResp); err != nil {
+			httpResp.Body.Close()
+			return &Response{
+				StatusCode: httpResp.StatusCode,
+				Header:     httpResp.Header,
+			}, errorsx.Trace(err)
+		}
+	}
+	return &Response{
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Body:       httpResp.Body,
+	}, nil
+}
+
+func (r *Request) do(ctx context.Context) (*http.Response, error) {
+	reqURL, err := r.buildURL()
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	reqBody, contentType, err := r.buildBody()
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, r.method, reqURL, reqBody)
+	if err != nil {
+		closeBody(reqBody)
+		return nil, errorsx.Trace(err)
+	}
+	if r.options.reqInterceptor != nil {
+		if err := r.options.reqInterceptor(httpReq); err != nil {
+			closeBody(reqBody)
+			return nil, errorsx.Trace(err)
+		}
+	}
+	if contentType != "" {
+		httpReq.Header.Set(ContentTypeHeader, contentType)
+	}
+	for key, values := range r.header {
+		httpReq.Header.Del(key)
+		for _, value := range values {
+			httpReq.Header.Add(key, value)
+		}
+	}
+	httpResp, err := r.options.client.Do(httpReq)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return httpResp, nil
+}
+
+func closeBody(body io.Reader) {
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func (r *Request) buildURL() (string, error) {
+	if len(r.query) == 0 {
+		return r.url, nil
+	}
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return "", errorsx.Trace(err)
+	}
+	query := u.Query()
+	for key, values := range r.query {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (r *Request) buildBody() (io.Reader, string, error) {
+	switch {
+	case r.reader != nil:
+		return r.reader, r.contentType, nil
+	case r.form != nil:
+		return strings.NewReader(r.form.Encode()), ContentTypeForm, nil
+	case len(r.parts) != 0:
+		body, contentType := r.buildMultipartBody()
+		return body, contentType, nil
+	case r.hasBody:
+		reqData, err := r.options.codec.Encode(r.body)
+		if err != nil {
+			return nil, "", errorsx.Trace(err)
+		}
+		return bytes.NewReader(reqData), "", nil
+	default:
+		return nil, "", nil
+	}
+}
+
+func (r *Request) buildMultipartBody() (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	syncx.SafeGo(func() {
+		pw.CloseWithError(writeMultipart(mw, r.parts))
+	})
+	return pr, mw.FormDataContentType()
+}
+
+func writeMultipart(mw *multipart.Writer, parts []*multipartPart) error {
+	for _, part := range parts {
+		if part.content == nil {
+			if err := mw.WriteField(part.field, part.value); err != nil {
+				return errorsx.Trace(err)
+			}
+			continue
+		}
+		w, err := mw.CreateFormFile(part.field, part.filename)
+		if err != nil {
+			return errorsx.Trace(err)
+		}
+		if _, err := io.Copy(w, part.content); err != nil {
+			return errorsx.Trace(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
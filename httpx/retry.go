@@ -0,0 +1,203 @@
+package httpx
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+// consts
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	RetryAfterHeader     = "Retry-After"
+)
+
+// vars
+var (
+	DefaultRetryInitialBackoff    = 100 * time.Millisecond
+	DefaultRetryInitialBackoffStr = DefaultRetryInitialBackoff.String()
+	DefaultRetryMaxBackoff        = 2 * time.Second
+	DefaultRetryMaxBackoffStr     = DefaultRetryMaxBackoff.String()
+	DefaultRetryMultiplier        = 2.0
+	DefaultRetryJitter            = 0.2
+	DefaultRetryNonIdempotent     = false
+	DefaultRetryRespectRetryAfter = true
+	DefaultRetryMaxRetryAfter     = 10 * time.Second
+	DefaultRetryMaxRetryAfterStr  = DefaultRetryMaxRetryAfter.String()
+	idempotentMethods             = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+		http.MethodPut:     true,
+		http.MethodDelete:  true,
+	}
+)
+
+// RetryPolicy RetryPolicy
+type RetryPolicy struct {
+	InitialBackoff     *string  `toml:"initial_backoff" yaml:"initial_backoff" json:"initial_backoff"`
+	MaxBackoff         *string  `toml:"max_backoff" yaml:"max_backoff" json:"max_backoff"`
+	Multiplier         *float64 `toml:"multiplier" yaml:"multiplier" json:"multiplier"`
+	Jitter             *float64 `toml:"jitter" yaml:"jitter" json:"jitter"`
+	RetryNonIdempotent *bool    `toml:"retry_non_idempotent" yaml:"retry_non_idempotent" json:"retry_non_idempotent"`
+	RespectRetryAfter  *bool    `toml:"respect_retry_after" yaml:"respect_retry_after" json:"respect_retry_after"`
+	MaxRetryAfter      *string  `toml:"max_retry_after" yaml:"max_retry_after" json:"max_retry_after"`
+}
+
+var (
+	defaultRetryPolicy = &RetryPolicy{
+		InitialBackoff:     &DefaultRetryInitialBackoffStr,
+		MaxBackoff:         &DefaultRetryMaxBackoffStr,
+		Multiplier:         &DefaultRetryMultiplier,
+		Jitter:             &DefaultRetryJitter,
+		RetryNonIdempotent: &DefaultRetryNonIdempotent,
+		RespectRetryAfter:  &DefaultRetryRespectRetryAfter,
+		MaxRetryAfter:      &DefaultRetryMaxRetryAfterStr,
+	}
+)
+
+func (p *RetryPolicy) fill() {
+	if p.InitialBackoff == nil || *p.InitialBackoff == "" {
+		p.InitialBackoff = &DefaultRetryInitialBackoffStr
+	}
+	if p.MaxBackoff == nil || *p.MaxBackoff == "" {
+		p.MaxBackoff = &DefaultRetryMaxBackoffStr
+	}
+	if p.Multiplier == nil || *p.Multiplier < 1 {
+		p.Multiplier = &DefaultRetryMultiplier
+	}
+	if p.Jitter == nil || *p.Jitter < 0 || *p.Jitter > 1 {
+		p.Jitter = &DefaultRetryJitter
+	}
+	if p.RetryNonIdempotent == nil {
+		p.RetryNonIdempotent = &DefaultRetryNonIdempotent
+	}
+	if p.RespectRetryAfter == nil {
+		p.RespectRetryAfter = &DefaultRetryRespectRetryAfter
+	}
+	if p.MaxRetryAfter == nil || *p.MaxRetryAfter == "" {
+		p.MaxRetryAfter = &DefaultRetryMaxRetryAfterStr
+	}
+}
+
+type retryPolicy struct {
+	initialBackoff     time.Duration
+	maxBackoff         time.Duration
+	multiplier         float64
+	jitter             float64
+	retryNonIdempotent bool
+	respectRetryAfter  bool
+	maxRetryAfter      time.Duration
+}
+
+func buildRetryPolicy(p *RetryPolicy) *retryPolicy {
+	if p == nil {
+		p = defaultRetryPolicy
+	}
+	p.fill()
+	policy := &retryPolicy{
+		initialBackoff:     DefaultRetryInitialBackoff,
+		maxBackoff:         DefaultRetryMaxBackoff,
+		multiplier:         *p.Multiplier,
+		jitter:             *p.Jitter,
+		retryNonIdempotent: *p.RetryNonIdempotent,
+		respectRetryAfter:  *p.RespectRetryAfter,
+		maxRetryAfter:      DefaultRetryMaxRetryAfter,
+	}
+	initialBackoff, err := time.ParseDuration(*p.InitialBackoff)
+	if err == nil && initialBackoff > 0 {
+		policy.initialBackoff = initialBackoff
+	}
+	if err != nil {
+		log.WithField("initial_backoff", *p.InitialBackoff).
+			Error(err)
+	}
+	maxBackoff, err := time.ParseDuration(*p.MaxBackoff)
+	if err == nil && maxBackoff > 0 {
+		policy.maxBackoff = maxBackoff
+	}
+	if err != nil {
+		log.WithField("max_backoff", *p.MaxBackoff).
+			Error(err)
+	}
+	maxRetryAfter, err := time.ParseDuration(*p.MaxRetryAfter)
+	if err == nil && maxRetryAfter > 0 {
+		policy.maxRetryAfter = maxRetryAfter
+	}
+	if err != nil {
+		log.WithField("max_retry_after", *p.MaxRetryAfter).
+			Error(err)
+	}
+	return policy
+}
+
+// retryable 非幂等请求默认不重试,除非带有Idempotency-Key
+func (p *retryPolicy) retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if idempotentMethods[req.Method] {
+		return true
+	}
+	return p.retryNonIdempotent || req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// backoff 第retries次重试前的等待时间, ok为false时表示不应再重试
+func (p *retryPolicy) backoff(retries int, resp *http.Response) (time.Duration, bool) {
+	if p.respectRetryAfter && resp != nil &&
+		(resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if wait, ok := parseRetryAfter(resp.Header.Get(RetryAfterHeader)); ok {
+			if wait > p.maxRetryAfter {
+				return 0, false
+			}
+			return wait, true
+		}
+	}
+	backoff := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(retries))
+	if backoff > float64(p.maxBackoff) {
+		backoff = float64(p.maxBackoff)
+	}
+	if p.jitter > 0 {
+		backoff = backoff * (1 + p.jitter*(rand.Float64()*2-1))
+	}
+	return time.Duration(backoff), true
+}
+
+func parseRetryAfter(val string) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(val); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(val)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Until(t)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errorsx.Trace(ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
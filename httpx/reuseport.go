@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package httpx
+
+import (
+	"syscall"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"golang.org/x/sys/unix"
+)
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if sockErr != nil {
+		return errorsx.Trace(sockErr)
+	}
+	return nil
+}
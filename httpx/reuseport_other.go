@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package httpx
+
+import (
+	"syscall"
+
+	"github.com/wwq-2020/go.common/errorsx"
+)
+
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errorsx.New("reuseport not supported")
+}
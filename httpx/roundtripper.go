@@ -0,0 +1,269 @@
+package httpx
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/stack"
+	"github.com/wwq-2020/go.common/tracing"
+)
+
+// middleware names
+const (
+	TracingMiddlewareName     = "tracing"
+	LoggingMiddlewareName     = "logging"
+	MetricsMiddlewareName     = "metrics"
+	RetryMiddlewareName       = "retry"
+	BreakerMiddlewareName     = "breaker"
+	BulkheadMiddlewareName    = "bulkhead"
+	CacheMiddlewareName       = "cache"
+	RateLimitMiddlewareName   = "ratelimit"
+	ClientTraceMiddlewareName = "clienttrace"
+	OAuth2MiddlewareName      = "oauth2"
+)
+
+// RoundTripperFunc RoundTripperFunc
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip RoundTrip
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// RoundTripperMiddleware RoundTripperMiddleware
+type RoundTripperMiddleware func(http.RoundTripper) http.RoundTripper
+
+// ChainRoundTripperMiddleware 第一个中间件在最外层
+func ChainRoundTripperMiddleware(middlewares ...RoundTripperMiddleware) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		chained := rt
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			chained = middlewares[i](chained)
+		}
+		return chained
+	}
+}
+
+// RoundTripperMiddlewareFactory RoundTripperMiddlewareFactory
+type RoundTripperMiddlewareFactory func(*TransportConf) RoundTripperMiddleware
+
+var (
+	roundTripperMiddlewareFactories = map[string]RoundTripperMiddlewareFactory{
+		TracingMiddlewareName: func(*TransportConf) RoundTripperMiddleware {
+			return TracingMiddleware
+		},
+		LoggingMiddlewareName: func(*TransportConf) RoundTripperMiddleware {
+			return LoggingMiddleware
+		},
+		MetricsMiddlewareName: func(*TransportConf) RoundTripperMiddleware {
+			return MetricsMiddleware
+		},
+		RetryMiddlewareName: func(c *TransportConf) RoundTripperMiddleware {
+			return RetryMiddleware(*c.MaxRetry, c.RetryCheck, c.RetryPolicy)
+		},
+		BreakerMiddlewareName: func(c *TransportConf) RoundTripperMiddleware {
+			return BreakerMiddleware(c.Breaker)
+		},
+		BulkheadMiddlewareName: func(c *TransportConf) RoundTripperMiddleware {
+			return BulkheadMiddleware(c.Bulkhead)
+		},
+		RateLimitMiddlewareName: func(c *TransportConf) RoundTripperMiddleware {
+			return RateLimitMiddleware(c.RateLimit)
+		},
+		ClientTraceMiddlewareName: func(*TransportConf) RoundTripperMiddleware {
+			return ClientTraceMiddleware
+		},
+		CacheMiddlewareName: func(c *TransportConf) RoundTripperMiddleware {
+			storage, err := MakeCacheStorage(c.Cache)
+			if err != nil {
+				log.Error(err)
+				return func(rt http.RoundTripper) http.RoundTripper {
+					return rt
+				}
+			}
+			maxEntryBytes := DefaultCacheMaxEntryBytes
+			if c.Cache != nil {
+				maxEntryBytes = *c.Cache.MaxEntryBytes
+			}
+			return CacheMiddlewareEx(storage, maxEntryBytes)
+		},
+	}
+	roundTripperMiddlewareFactoriesM sync.RWMutex
+)
+
+// RegisterRoundTripperMiddleware 注册后可在TransportConf.Middlewares中按名字引用
+func RegisterRoundTripperMiddleware(name string, factory RoundTripperMiddlewareFactory) {
+	roundTripperMiddlewareFactoriesM.Lock()
+	defer roundTripperMiddlewareFactoriesM.Unlock()
+	roundTripperMiddlewareFactories[name] = factory
+}
+
+func defaultMiddlewareNames(c *TransportConf) []string {
+	names := make([]string, 0, 10)
+	if c.Cache != nil {
+		names = append(names, CacheMiddlewareName)
+	}
+	if c.Bulkhead != nil {
+		names = append(names, BulkheadMiddlewareName)
+	}
+	if c.Breaker != nil {
+		names = append(names, BreakerMiddlewareName)
+	}
+	names = append(names, TracingMiddlewareName, LoggingMiddlewareName)
+	if c.OAuth2 != nil {
+		names = append(names, OAuth2MiddlewareName)
+	}
+	names = append(names, RetryMiddlewareName)
+	if c.RateLimit != nil {
+		names = append(names, RateLimitMiddlewareName)
+	}
+	return append(names, MetricsMiddlewareName, ClientTraceMiddlewareName)
+}
+
+func buildRoundTripperMiddleware(c *TransportConf) RoundTripperMiddleware {
+	if len(c.RoundTripperMiddlewares) != 0 {
+		return ChainRoundTripperMiddleware(c.RoundTripperMiddlewares...)
+	}
+	names := c.Middlewares
+	if len(names) == 0 {
+		names = defaultMiddlewareNames(c)
+	}
+	roundTripperMiddlewareFactoriesM.RLock()
+	defer roundTripperMiddlewareFactoriesM.RUnlock()
+	middlewares := make([]RoundTripperMiddleware, 0, len(names))
+	for _, name := range names {
+		factory, exist := roundTripperMiddlewareFactories[name]
+		if !exist {
+			log.WithField("middleware", name).
+				Error(errorsx.New("unknown middleware"))
+			continue
+		}
+		middlewares = append(middlewares, factory(c))
+	}
+	return ChainRoundTripperMiddleware(middlewares...)
+}
+
+// TracingMiddleware TracingMiddleware
+func TracingMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var err error
+		ctx := req.Context()
+		stack := stack.New().
+			Set("httpmethod", req.Method).
+			Set("url", req.URL.String())
+		span, ctx := tracing.StartSpan(ctx, "RoundTrip")
+		defer span.FinishWithFields(&err, stack)
+		req = req.WithContext(ctx)
+		span.InjectToHTTPReq(req)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		stack.Set("httpStatusCode", resp.StatusCode)
+		return resp, nil
+	})
+}
+
+// LoggingMiddleware LoggingMiddleware
+func LoggingMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		start := time.Now()
+		stack := stack.New().
+			Set("httpmethod", req.Method).
+			Set("url", req.URL.String()).
+			Set("invokeStart", start.Format("2006-01-02 15:04:05"))
+		if reqData, ok := peekBody(req); ok {
+			stack.Set("reqBody", string(reqData))
+		}
+		log.WithFields(stack).
+			InfoContext(ctx, "start invoke")
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			log.WithFields(stack).
+				ErrorContext(ctx, err)
+			return nil, errorsx.Trace(err)
+		}
+		logger := log.WithField("respContentLength", resp.ContentLength)
+		// 只读取长度已知且足够小的body,流式及大文件响应原样透传
+		if resp.ContentLength >= 0 && resp.ContentLength <= maxLogBodySize {
+			respData, respBody, err := DrainBody(resp.Body)
+			if err != nil {
+				resp.Body.Close()
+				log.WithFields(stack).
+					ErrorContext(ctx, err)
+				return nil, errorsx.Trace(err)
+			}
+			resp.Body = respBody
+			logger = logger.WithField("respData", string(respData))
+		}
+		end := time.Now()
+		logger.WithField("elapsed", end.Sub(start).Milliseconds()).
+			WithField("httpStatusCode", resp.StatusCode).
+			WithField("invokeFinish", end.Format("2006-01-02 15:04:05")).
+			InfoContext(ctx, "invoke finish")
+		return resp, nil
+	})
+}
+
+// peekBody 仅在body可重复读取且足够小时读取,用于日志
+func peekBody(req *http.Request) ([]byte, bool) {
+	if req.GetBody == nil || req.ContentLength <= 0 || req.ContentLength > maxLogBodySize {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// MetricsMiddleware MetricsMiddleware
+func MetricsMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := rt.RoundTrip(req)
+		code := "error"
+		if err == nil {
+			code = strconv.Itoa(resp.StatusCode)
+		}
+		clientRequestDuration.WithLabelValues(req.URL.Host, req.Method, code).
+			Observe(time.Since(start).Seconds())
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		return resp, nil
+	})
+}
+
+// AuthHeaderMiddleware 每次请求通过authorization获取Authorization头
+func AuthHeaderMiddleware(authorization func(ctx context.Context) (string, error)) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			value, err := authorization(ctx)
+			if err != nil {
+				closeBody(req.Body)
+				return nil, errorsx.Trace(err)
+			}
+			req = req.Clone(ctx)
+			req.Header.Set(AuthorizationHeader, value)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			return resp, nil
+		})
+	}
+}
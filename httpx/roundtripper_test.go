@@ -0,0 +1,57 @@
+package httpx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestRoundTripperMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(httpx.AuthorizationHeader)))
+	}))
+	defer srv.Close()
+	var order []string
+	record := func(name string) httpx.RoundTripperMiddleware {
+		return func(rt http.RoundTripper) http.RoundTripper {
+			return httpx.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return rt.RoundTrip(req)
+			})
+		}
+	}
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			RoundTripperMiddlewares: []httpx.RoundTripperMiddleware{
+				record("first"),
+				httpx.AuthHeaderMiddleware(func(ctx context.Context) (string, error) {
+					return "Bearer token", nil
+				}),
+				record("second"),
+				httpx.MetricsMiddleware,
+			},
+		},
+	})
+	resp, err := httpx.NewRequest(http.MethodGet, srv.URL, httpx.WithClient(client)).
+		Stream(context.TODO())
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	expectedOrder := []string{"first", "second"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Fatalf("expected:%v,got:%v", expectedOrder, order)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if string(data) != "Bearer token" {
+		t.Fatalf("expected:%s,got:%s", "Bearer token", data)
+	}
+}
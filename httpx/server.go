@@ -1,11 +1,17 @@
 package httpx
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/wwq-2020/go.common/app"
+	"github.com/wwq-2020/go.common/errorsx"
 	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/util"
+	"golang.org/x/net/netutil"
 )
 
 // vars
@@ -21,6 +27,10 @@ var (
 	DefaultServerIdleTimeoutStr       = DefaultServerIdleTimeout.String()
 	DefaultServerMaxHeaderBytes       = 1 << 20
 	DefaultServerMaxHeaderBytesStr    = util.ToByteStr(int64(DefaultServerMaxHeaderBytes))
+	DefaultServerReusePort            = false
+	DefaultServerMaxConns             = 0
+	DefaultServerShutdownTimeout      = time.Second * 10
+	DefaultServerShutdownTimeoutStr   = DefaultServerShutdownTimeout.String()
 )
 
 // ServerConf ServerConf
@@ -31,6 +41,11 @@ type ServerConf struct {
 	WriteTimeout      *string `toml:"write_timeout" yaml:"write_timeout" json:"write_timeout"`
 	IdleTimeout       *string `toml:"idle_timeout" yaml:"idle_timeout" json:"idle_timeout"`
 	MaxHeaderBytes    *string `toml:"max_header_bytes" yaml:"max_header_bytes" json:"max_header_bytes"`
+	CertFile          string  `toml:"cert_file" yaml:"cert_file" json:"cert_file" nullable:"true"`
+	KeyFile           string  `toml:"key_file" yaml:"key_file" json:"key_file" nullable:"true"`
+	ReusePort         *bool   `toml:"reuse_port" yaml:"reuse_port" json:"reuse_port" nullable:"true"`
+	MaxConns          *int    `toml:"max_conns" yaml:"max_conns" json:"max_conns" nullable:"true"`
+	ShutdownTimeout   *string `toml:"shutdown_timeout" yaml:"shutdown_timeout" json:"shutdown_timeout" nullable:"true"`
 	Handler           http.Handler
 }
 
@@ -53,6 +68,15 @@ func (s *ServerConf) fill() {
 	if s.MaxHeaderBytes == nil || *s.MaxHeaderBytes == "" {
 		s.MaxHeaderBytes = &DefaultServerMaxHeaderBytesStr
 	}
+	if s.ReusePort == nil {
+		s.ReusePort = &DefaultServerReusePort
+	}
+	if s.MaxConns == nil || *s.MaxConns < 0 {
+		s.MaxConns = &DefaultServerMaxConns
+	}
+	if s.ShutdownTimeout == nil || *s.ShutdownTimeout == "" {
+		s.ShutdownTimeout = &DefaultServerShutdownTimeoutStr
+	}
 }
 
 var defaultServerConf = &ServerConf{
@@ -62,6 +86,9 @@ var defaultServerConf = &ServerConf{
 	WriteTimeout:      &DefaultServerWriteTimeoutStr,
 	IdleTimeout:       &DefaultServerIdleTimeoutStr,
 	MaxHeaderBytes:    &DefaultServerMaxHeaderBytesStr,
+	ReusePort:         &DefaultServerReusePort,
+	MaxConns:          &DefaultServerMaxConns,
+	ShutdownTimeout:   &DefaultServerShutdownTimeoutStr,
 }
 
 // MakeServer MakeServer
@@ -84,7 +111,7 @@ func MakeServer(conf *ServerConf) *http.Server {
 		server.ReadTimeout = readTimeout
 	}
 	if err != nil {
-		log.WithField("read_timeout", conf.ReadTimeout).
+		log.WithField("read_timeout", *conf.ReadTimeout).
 			Error(err)
 	}
 	readHeaderTimeout, err := time.ParseDuration(*conf.ReadHeaderTimeout)
@@ -92,7 +119,7 @@ func MakeServer(conf *ServerConf) *http.Server {
 		server.ReadHeaderTimeout = readHeaderTimeout
 	}
 	if err != nil {
-		log.WithField("read_header_timeout", conf.ReadHeaderTimeout).
+		log.WithField("read_header_timeout", *conf.ReadHeaderTimeout).
 			Error(err)
 	}
 	writeTimeout, err := time.ParseDuration(*conf.WriteTimeout)
@@ -100,7 +127,7 @@ func MakeServer(conf *ServerConf) *http.Server {
 		server.WriteTimeout = writeTimeout
 	}
 	if err != nil {
-		log.WithField("write_timeout", conf.WriteTimeout).
+		log.WithField("write_timeout", *conf.WriteTimeout).
 			Error(err)
 	}
 	idleTimeout, err := time.ParseDuration(*conf.IdleTimeout)
@@ -108,7 +135,7 @@ func MakeServer(conf *ServerConf) *http.Server {
 		server.IdleTimeout = idleTimeout
 	}
 	if err != nil {
-		log.WithField("idle_timeout", conf.IdleTimeout).
+		log.WithField("idle_timeout", *conf.IdleTimeout).
 			Error(err)
 	}
 
@@ -117,7 +144,7 @@ func MakeServer(conf *ServerConf) *http.Server {
 		server.MaxHeaderBytes = int(maxHeaderBytes)
 	}
 	if err != nil {
-		log.WithField("max_header_bytes", conf.MaxHeaderBytes).
+		log.WithField("max_header_bytes", *conf.MaxHeaderBytes).
 			Error(err)
 	}
 	return server
@@ -127,3 +154,114 @@ func MakeServer(conf *ServerConf) *http.Server {
 func DefaultServer() *http.Server {
 	return MakeServer(defaultServerConf)
 }
+
+// Server Server
+type Server struct {
+	server          *http.Server
+	certFile        string
+	keyFile         string
+	reusePort       bool
+	maxConns        int
+	shutdownTimeout time.Duration
+	listener        net.Listener
+	hookOnce        sync.Once
+	m               sync.Mutex
+}
+
+// NewServer 带有trace和recovery中间件的server,Start后会注册app退出hook实现优雅退出
+func NewServer(conf *ServerConf, middlewares ...Middleware) *Server {
+	if conf == nil {
+		conf = defaultServerConf
+	}
+	conf.fill()
+	server := MakeServer(conf)
+	handler := server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	middleware := ChainMiddleware(append([]Middleware{TraceMiddleware, RecoveryMiddleware}, middlewares...)...)
+	server.Handler = middleware(handler)
+
+	shutdownTimeout, err := time.ParseDuration(*conf.ShutdownTimeout)
+	if err != nil || shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultServerShutdownTimeout
+	}
+	if err != nil {
+		log.WithField("shutdown_timeout", *conf.ShutdownTimeout).
+			Error(err)
+	}
+	return &Server{
+		server:          server,
+		certFile:        conf.CertFile,
+		keyFile:         conf.KeyFile,
+		reusePort:       *conf.ReusePort,
+		maxConns:        *conf.MaxConns,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+// Start Start
+func (s *Server) Start() error {
+	listener, err := s.listen()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	s.hookOnce.Do(func() {
+		app.AddShutdownHook(s.shutdown)
+	})
+	if s.certFile != "" || s.keyFile != "" {
+		err = s.server.ServeTLS(listener, s.certFile, s.keyFile)
+	} else {
+		err = s.server.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+// Stop Stop
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.server.Shutdown(ctx); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+// Addr 监听地址,Start之前为nil
+func (s *Server) Addr() net.Addr {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	lc := &net.ListenConfig{}
+	if s.reusePort {
+		lc.Control = reusePortControl
+	}
+	listener, err := lc.Listen(context.Background(), "tcp", s.server.Addr)
+	if err != nil {
+		return nil, errorsx.Trace(err).
+			WithField("addr", s.server.Addr)
+	}
+	if s.maxConns > 0 {
+		listener = netutil.LimitListener(listener, s.maxConns)
+	}
+	s.m.Lock()
+	s.listener = listener
+	s.m.Unlock()
+	return listener, nil
+}
+
+func (s *Server) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		log.WithField("addr", s.server.Addr).
+			Error(err)
+	}
+}
@@ -0,0 +1,118 @@
+package httpx_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/httpx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+func TestServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("panic")
+	})
+	maxConns := 10
+	s := httpx.NewServer(&httpx.ServerConf{
+		Addr:     "127.0.0.1:0",
+		MaxConns: &maxConns,
+		Handler:  mux,
+	})
+	go s.Start()
+	defer s.Stop(context.TODO())
+	for i := 0; i < 100 && s.Addr() == nil; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if s.Addr() == nil {
+		t.Fatalf("expected:addr,got:nil")
+	}
+	base := "http://" + s.Addr().String()
+	resp, err := http.Get(base + "/ok")
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected:%d,got:%d", http.StatusOK, resp.StatusCode)
+	}
+	resp, err = http.Get(base + "/panic")
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected:%d,got:%d", http.StatusInternalServerError, resp.StatusCode)
+	}
+}
+
+func TestTraceMiddlewareFlusherHijacker(t *testing.T) {
+	handler := httpx.TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 204 No Content\r\nConnection: close\r\n\r\n")
+		buf.Flush()
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected:%d,got:%d", http.StatusNoContent, resp.StatusCode)
+	}
+}
+
+func TestTraceMiddlewareExLogBody(t *testing.T) {
+	handler := httpx.TraceMiddlewareEx(httpx.TraceOptions{
+		LogBody: true,
+		Context: func(ctx context.Context, req *http.Request) context.Context {
+			return log.ContextWithField(ctx, "tenant", req.Header.Get("X-Tenant"))
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		tenant := log.FieldsFromContext(r.Context()).KVs()["tenant"]
+		fmt.Fprintf(w, "%s:%v", data, tenant)
+	}))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("hello"))
+	req.Header.Set("X-Tenant", "t1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if string(data) != "hello:t1" {
+		t.Fatalf("expected:%s,got:%s", "hello:t1", data)
+	}
+}
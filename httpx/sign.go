@@ -0,0 +1,463 @@
+package httpx
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+// consts
+const (
+	HMACSignAlgorithm     = "HMAC-SHA256"
+	SignDateHeader        = "X-Httpx-Date"
+	SignNonceHeader       = "X-Httpx-Nonce"
+	SignContentHashHeader = "X-Httpx-Content-Sha256"
+	SigV4Algorithm        = "AWS4-HMAC-SHA256"
+	SigV4DateHeader       = "X-Amz-Date"
+	SigV4ContentHeader    = "X-Amz-Content-Sha256"
+	SigV4TokenHeader      = "X-Amz-Security-Token"
+	signTimeFormat        = "20060102T150405Z"
+	sigV4DateFormat       = "20060102"
+)
+
+// errs
+var (
+	ErrSignatureMissing  = errorsx.Std("signature missing")
+	ErrSignatureMismatch = errorsx.Std("signature mismatch")
+	ErrSignatureExpired  = errorsx.Std("signature expired")
+	ErrSignatureReplayed = errorsx.Std("signature replayed")
+)
+
+// vars
+var (
+	DefaultSignMaxClockSkew = 5 * time.Minute
+	DefaultSignMaxBodyBytes = int64(10 << 20)
+)
+
+// Signer Signer
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc SignerFunc
+type SignerFunc func(req *http.Request) error
+
+// Sign Sign
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// SignReqInterceptor Request.Header设置的头在拦截器之后才写入,需要签名这些头时使用SignMiddleware
+func SignReqInterceptor(signer Signer) ReqInterceptor {
+	return func(httpReq *http.Request) error {
+		if err := signer.Sign(httpReq); err != nil {
+			return errorsx.Trace(err)
+		}
+		return nil
+	}
+}
+
+// SignMiddleware 放在retry之内时每次重试都会重新签名
+func SignMiddleware(signer Signer) RoundTripperMiddleware {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := signer.Sign(req); err != nil {
+				closeBody(req.Body)
+				return nil, errorsx.Trace(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			return resp, nil
+		})
+	}
+}
+
+type hmacSigner struct {
+	keyID         string
+	secret        []byte
+	signedHeaders []string
+}
+
+// NewHMACSigner 除signedHeaders外总是签名host、日期、nonce及body哈希
+func NewHMACSigner(keyID string, secret []byte, signedHeaders ...string) Signer {
+	return &hmacSigner{
+		keyID:         keyID,
+		secret:        secret,
+		signedHeaders: normalizeSignedHeaders(append(signedHeaders, "host", SignDateHeader, SignNonceHeader, SignContentHashHeader)),
+	}
+}
+
+func (s *hmacSigner) Sign(req *http.Request) error {
+	payloadHash, err := hashReqBody(req)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return errorsx.Trace(err)
+	}
+	req.Header.Set(SignDateHeader, time.Now().UTC().Format(signTimeFormat))
+	req.Header.Set(SignNonceHeader, hex.EncodeToString(nonce))
+	req.Header.Set(SignContentHashHeader, payloadHash)
+	canonical := canonicalRequest(req, s.signedHeaders, payloadHash, req.URL.EscapedPath())
+	signature := hex.EncodeToString(hmacSHA256(s.secret, []byte(canonical)))
+	req.Header.Set(AuthorizationHeader, fmt.Sprintf("%s KeyId=%s, SignedHeaders=%s, Signature=%s",
+		HMACSignAlgorithm, s.keyID, strings.Join(s.signedHeaders, ";"), signature))
+	return nil
+}
+
+// SigV4Conf SigV4Conf
+type SigV4Conf struct {
+	AccessKeyID     *string `toml:"access_key_id" yaml:"access_key_id" json:"access_key_id"`
+	SecretAccessKey *string `toml:"secret_access_key" yaml:"secret_access_key" json:"secret_access_key" secret:"true"`
+	SessionToken    *string `toml:"session_token" yaml:"session_token" json:"session_token" secret:"true" nullable:"true"`
+	Region          *string `toml:"region" yaml:"region" json:"region"`
+	Service         *string `toml:"service" yaml:"service" json:"service"`
+}
+
+type sigV4Signer struct {
+	conf *SigV4Conf
+}
+
+// NewSigV4Signer 兼容AWS Signature Version 4
+func NewSigV4Signer(conf *SigV4Conf) Signer {
+	return &sigV4Signer{conf: conf}
+}
+
+func (s *sigV4Signer) Sign(req *http.Request) error {
+	payloadHash, err := hashReqBody(req)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	now := time.Now().UTC()
+	req.Header.Set(SigV4DateHeader, now.Format(signTimeFormat))
+	req.Header.Set(SigV4ContentHeader, payloadHash)
+	if s.conf.SessionToken != nil && *s.conf.SessionToken != "" {
+		req.Header.Set(SigV4TokenHeader, *s.conf.SessionToken)
+	}
+	// 仅签名host、content-type及x-amz-*,避免被代理改写的头导致签名失效
+	signedHeaders := make([]string, 0, len(req.Header)+1)
+	signedHeaders = append(signedHeaders, "host")
+	for name := range req.Header {
+		if name == ContentTypeHeader || strings.HasPrefix(strings.ToLower(name), "x-amz-") {
+			signedHeaders = append(signedHeaders, name)
+		}
+	}
+	signedHeaders = normalizeSignedHeaders(signedHeaders)
+	// s3以外的服务path需要编码两次
+	path := uriEncode(req.URL.Path, false)
+	if *s.conf.Service != "s3" {
+		path = uriEncode(req.URL.EscapedPath(), false)
+	}
+	canonical := canonicalRequest(req, signedHeaders, payloadHash, path)
+	date := now.Format(sigV4DateFormat)
+	scope := strings.Join([]string{date, *s.conf.Region, *s.conf.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{SigV4Algorithm, now.Format(signTimeFormat), scope, hashHex([]byte(canonical))}, "\n")
+	key := hmacSHA256([]byte("AWS4"+*s.conf.SecretAccessKey), []byte(date))
+	key = hmacSHA256(key, []byte(*s.conf.Region))
+	key = hmacSHA256(key, []byte(*s.conf.Service))
+	key = hmacSHA256(key, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSHA256(key, []byte(stringToSign)))
+	req.Header.Set(AuthorizationHeader, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		SigV4Algorithm, *s.conf.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+	return nil
+}
+
+// canonicalRequest method、path、排序后的query、签名头及body哈希,按行拼接
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash, path string) string {
+	if path == "" {
+		path = "/"
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(req.Method)
+	buf.WriteByte('\n')
+	buf.WriteString(path)
+	buf.WriteByte('\n')
+	buf.WriteString(canonicalQuery(req.URL.Query()))
+	buf.WriteByte('\n')
+	for _, name := range signedHeaders {
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(canonicalHeaderValue(req, name))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	buf.WriteString(strings.Join(signedHeaders, ";"))
+	buf.WriteByte('\n')
+	buf.WriteString(payloadHash)
+	return buf.String()
+}
+
+// canonicalQuery 按编码后的key排序,key相同时按编码后的value排序
+func canonicalQuery(query url.Values) string {
+	pairs := make([][2]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, [2]string{uriEncode(key, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	encoded := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		encoded = append(encoded, pair[0]+"="+pair[1])
+	}
+	return strings.Join(encoded, "&")
+}
+
+func canonicalHeaderValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+	values := req.Header.Values(name)
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(trimmed, ",")
+}
+
+func normalizeSignedHeaders(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// uriEncode 按RFC 3986编码,仅保留unreserved字符
+func uriEncode(s string, encodeSlash bool) string {
+	buf := bytes.NewBuffer(nil)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(buf, "%%%02X", c)
+	}
+	return buf.String()
+}
+
+// hashReqBody body不可重复读取时会读入内存并设置GetBody
+func hashReqBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+	if req.GetBody == nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", errorsx.Trace(err)
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		req.Body, _ = req.GetBody()
+		return hashHex(data), nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", errorsx.Trace(err)
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", errorsx.Trace(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// NonceStore 记录已使用的nonce,Seen在nonce已出现过时返回true
+type NonceStore interface {
+	Seen(nonce string, ttl time.Duration) bool
+}
+
+type memoryNonceStore struct {
+	nonces map[string]time.Time
+	gcAt   time.Time
+	sync.Mutex
+}
+
+// NewMemoryNonceStore NewMemoryNonceStore
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+func (s *memoryNonceStore) Seen(nonce string, ttl time.Duration) bool {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	if now.After(s.gcAt) {
+		for each, expireAt := range s.nonces {
+			if now.After(expireAt) {
+				delete(s.nonces, each)
+			}
+		}
+		s.gcAt = now.Add(ttl)
+	}
+	if expireAt, exist := s.nonces[nonce]; exist && now.Before(expireAt) {
+		return true
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return false
+}
+
+// SignVerifyOptions SignVerifyOptions
+type SignVerifyOptions struct {
+	// Secret 根据KeyId返回密钥
+	Secret       func(keyID string) ([]byte, error)
+	MaxClockSkew time.Duration
+	MaxBodyBytes int64
+	NonceStore   NonceStore
+}
+
+// SignVerifyMiddleware 校验NewHMACSigner生成的签名,拒绝超出时钟偏差或重复的请求
+func SignVerifyMiddleware(options SignVerifyOptions) Middleware {
+	if options.MaxClockSkew <= 0 {
+		options.MaxClockSkew = DefaultSignMaxClockSkew
+	}
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = DefaultSignMaxBodyBytes
+	}
+	if options.NonceStore == nil {
+		options.NonceStore = NewMemoryNonceStore()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if err := verifyHMACSignature(req, &options); err != nil {
+				log.WithError(err).
+					WarnContext(ctx, "verify signature failed")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+func verifyHMACSignature(req *http.Request, options *SignVerifyOptions) error {
+	keyID, signedHeaders, signature, err := parseHMACAuthorization(req.Header.Get(AuthorizationHeader))
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	for _, required := range normalizeSignedHeaders([]string{"host", SignDateHeader, SignNonceHeader, SignContentHashHeader}) {
+		if !stringsContains(signedHeaders, required) {
+			return errorsx.Trace(ErrSignatureMissing).WithField("header", required)
+		}
+	}
+	date, err := time.Parse(signTimeFormat, req.Header.Get(SignDateHeader))
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if skew := time.Since(date); skew > options.MaxClockSkew || skew < -options.MaxClockSkew {
+		return errorsx.Trace(ErrSignatureExpired).WithField("date", date)
+	}
+	secret, err := options.Secret(keyID)
+	if err != nil {
+		return errorsx.Trace(err).WithField("keyID", keyID)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, options.MaxBodyBytes+1))
+	req.Body.Close()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if int64(len(data)) > options.MaxBodyBytes {
+		return errorsx.New("body too large").WithField("maxBodyBytes", options.MaxBodyBytes)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	payloadHash := hashHex(data)
+	if req.Header.Get(SignContentHashHeader) != payloadHash {
+		return errorsx.Trace(ErrSignatureMismatch).WithField("header", SignContentHashHeader)
+	}
+	canonical := canonicalRequest(req, signedHeaders, payloadHash, req.URL.EscapedPath())
+	expected := hmacSHA256(secret, []byte(canonical))
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, given) {
+		return errorsx.Trace(ErrSignatureMismatch)
+	}
+	// 签名通过后再记录nonce,避免伪造请求占用nonce
+	if options.NonceStore.Seen(keyID+":"+req.Header.Get(SignNonceHeader), 2*options.MaxClockSkew) {
+		return errorsx.Trace(ErrSignatureReplayed)
+	}
+	return nil
+}
+
+func parseHMACAuthorization(authorization string) (string, []string, string, error) {
+	prefix := HMACSignAlgorithm + " "
+	if !strings.HasPrefix(authorization, prefix) {
+		return "", nil, "", errorsx.Trace(ErrSignatureMissing)
+	}
+	var keyID, signedHeaders, signature string
+	for _, part := range strings.Split(strings.TrimPrefix(authorization, prefix), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "KeyId":
+			keyID = kv[1]
+		case "SignedHeaders":
+			signedHeaders = kv[1]
+		case "Signature":
+			signature = kv[1]
+		}
+	}
+	if keyID == "" || signedHeaders == "" || signature == "" {
+		return "", nil, "", errorsx.Trace(ErrSignatureMissing)
+	}
+	return keyID, strings.Split(signedHeaders, ";"), signature, nil
+}
+
+func stringsContains(parts []string, check string) bool {
+	for _, part := range parts {
+		if part == check {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package httpx_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestSignVerifyMiddleware(t *testing.T) {
+	var lastReq *http.Request
+	verify := httpx.SignVerifyMiddleware(httpx.SignVerifyOptions{
+		Secret: func(keyID string) ([]byte, error) {
+			if keyID != "key" {
+				return nil, errorsx.New("unknown key")
+			}
+			return []byte("secret"), nil
+		},
+	})
+	srv := httptest.NewServer(verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Data":"verified"}`))
+	})))
+	defer srv.Close()
+	capture := func(rt http.RoundTripper) http.RoundTripper {
+		return httpx.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			lastReq = req
+			return rt.RoundTrip(req)
+		})
+	}
+	makeClient := func(secret string) *http.Client {
+		return httpx.MakeClient(&httpx.ClientConf{
+			TransportConf: &httpx.TransportConf{
+				RoundTripperMiddlewares: []httpx.RoundTripperMiddleware{
+					httpx.SignMiddleware(httpx.NewHMACSigner("key", []byte(secret), httpx.ContentTypeHeader)),
+					capture,
+				},
+			},
+		})
+	}
+	resp := &resp{}
+	if err := httpx.Post(context.TODO(), srv.URL+"/a%2Fb?y=2&x=1", &req{Data: "body"}, resp, httpx.WithClient(makeClient("secret"))); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	if resp.Data != "verified" {
+		t.Fatalf("expected:%s,got:%s", "verified", resp.Data)
+	}
+	replay := lastReq.Clone(context.TODO())
+	replay.Body, _ = lastReq.GetBody()
+	replayResp, err := http.DefaultClient.Do(replay)
+	if err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	replayResp.Body.Close()
+	if replayResp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected:%d,got:%d", http.StatusUnauthorized, replayResp.StatusCode)
+	}
+	if err := httpx.Get(context.TODO(), srv.URL, resp, httpx.WithClient(makeClient("wrong"))); err == nil {
+		t.Fatal("expected err,got nil")
+	}
+}
+
+func TestSigV4Signer(t *testing.T) {
+	accessKeyID, secretAccessKey := "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	region, service := "us-east-1", "service"
+	signer := httpx.NewSigV4Signer(&httpx.SigV4Conf{
+		AccessKeyID:     &accessKeyID,
+		SecretAccessKey: &secretAccessKey,
+		Region:          &region,
+		Service:         &service,
+	})
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?Param2=value2&Param1=value1", nil)
+	if err := signer.Sign(req); err != nil {
+		t.Fatalf("expected nil,got:%v", err)
+	}
+	authorization := req.Header.Get(httpx.AuthorizationHeader)
+	expectedPrefix := httpx.SigV4Algorithm + " Credential=AKIDEXAMPLE/"
+	if !strings.HasPrefix(authorization, expectedPrefix) ||
+		!strings.Contains(authorization, "/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Fatalf("unexpected authorization:%s", authorization)
+	}
+}
+
+func TestSigV4SignerQueryKeyPrefix(t *testing.T) {
+	accessKeyID, secretAccessKey := "AKIDEXAMPLE", "secret"
+	region, service := "us-east-1", "service"
+	signer := httpx.NewSigV4Signer(&httpx.SigV4Conf{
+		AccessKeyID:     &accessKeyID,
+		SecretAccessKey: &secretAccessKey,
+		Region:          &region,
+		Service:         &service,
+	})
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?a-b=2&a=1", nil)
+	if err := signer.Sign(req); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	emptyHash := sha256.Sum256(nil)
+	payloadHash := hex.EncodeToString(emptyHash[:])
+	amzDate := req.Header.Get("X-Amz-Date")
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		"/",
+		"a=1&a-b=2",
+		"host:example.amazonaws.com",
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := amzDate[:8] + "/us-east-1/service/aws4_request"
+	stringToSign := strings.Join([]string{httpx.SigV4Algorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	expected := "Signature=" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if authorization := req.Header.Get(httpx.AuthorizationHeader); !strings.HasSuffix(authorization, expected) {
+		t.Fatalf("expected:%s,got:%s", expected, authorization)
+	}
+}
@@ -3,10 +3,25 @@ package httpx
 import (
 	"context"
 	"crypto/tls"
+	"io"
+	"net/http"
 	"net/http/httptrace"
 	"net/textproto"
+	"sync"
+	"time"
 
+	"github.com/wwq-2020/go.common/errorsx"
 	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/tracing"
+)
+
+// client trace phases
+const (
+	ClientTracePhaseDNS     = "dns"
+	ClientTracePhaseConnect = "connect"
+	ClientTracePhaseTLS     = "tls"
+	ClientTracePhaseTTFB    = "ttfb"
+	ClientTracePhaseTotal   = "total"
 )
 
 // ContextWithClientTrace ContextWithClientTrace
@@ -14,43 +29,103 @@ func ContextWithClientTrace(ctx context.Context) context.Context {
 	return httptrace.WithClientTrace(ctx, BuildClientTrace(ctx))
 }
 
-// BuildClientTrace BuildClientTrace
+// BuildClientTrace 统计dns、connect、tls及首字节耗时,记录到span和prometheus,各事件仅在Debug级别打印
 func BuildClientTrace(ctx context.Context) *httptrace.ClientTrace {
+	return newClientTimings(ctx, "").clientTrace()
+}
+
+type clientTimings struct {
+	ctx          context.Context
+	span         tracing.Span
+	host         string
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	sync.Mutex
+}
+
+func newClientTimings(ctx context.Context, host string) *clientTimings {
+	return &clientTimings{
+		ctx:   ctx,
+		span:  tracing.SpanFromContext(ctx),
+		host:  host,
+		start: time.Now(),
+	}
+}
+
+func (t *clientTimings) observe(phase string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	elapsed := time.Since(start)
+	t.Lock()
+	host := t.host
+	if t.span != nil {
+		t.span.WithField(phase+"Elapsed", elapsed.Milliseconds())
+	}
+	t.Unlock()
+	clientTraceDuration.WithLabelValues(host, phase).
+		Observe(elapsed.Seconds())
+}
+
+func (t *clientTimings) mark(start *time.Time) {
+	t.Lock()
+	*start = time.Now()
+	t.Unlock()
+}
+
+func (t *clientTimings) started(start *time.Time) time.Time {
+	t.Lock()
+	defer t.Unlock()
+	return *start
+}
+
+func (t *clientTimings) clientTrace() *httptrace.ClientTrace {
+	ctx := t.ctx
 	return &httptrace.ClientTrace{
 		GetConn: func(hostPort string) {
+			t.Lock()
+			if t.host == "" {
+				t.host = hostPort
+			}
+			t.Unlock()
 			log.WithField("hostPort", hostPort).
-				InfoContext(ctx, "GetConn")
+				DebugContext(ctx, "GetConn")
 		},
 		GotConn: func(gotConnInfo httptrace.GotConnInfo) {
 			log.WithField("WasIdle", gotConnInfo.WasIdle).
 				WithField("Reused", gotConnInfo.Reused).
 				WithField("IdleTime", gotConnInfo.IdleTime.Milliseconds()).
-				InfoContext(ctx, "GotConn")
+				DebugContext(ctx, "GotConn")
 		},
 		PutIdleConn: func(err error) {
 			if err != nil {
-				log.ErrorContext(ctx, err)
+				log.WithError(err).DebugContext(ctx, "PutIdleConn")
 			} else {
-				log.InfoContext(ctx, "PutIdleConn")
+				log.DebugContext(ctx, "PutIdleConn")
 			}
 		},
 		GotFirstResponseByte: func() {
-			log.InfoContext(ctx, "GotFirstResponseByte")
+			t.observe(ClientTracePhaseTTFB, t.start)
+			log.DebugContext(ctx, "GotFirstResponseByte")
 		},
 		Got100Continue: func() {
-			log.InfoContext(ctx, "Got100Continue")
+			log.DebugContext(ctx, "Got100Continue")
 		},
 		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
 			log.WithField("code", code).
 				WithField("header", header).
-				InfoContext(ctx, "Got1xxResponse")
+				DebugContext(ctx, "Got1xxResponse")
 			return nil
 		},
 		DNSStart: func(di httptrace.DNSStartInfo) {
+			t.mark(&t.dnsStart)
 			log.WithField("Host", di.Host).
-				InfoContext(ctx, "DNSStart")
+				DebugContext(ctx, "DNSStart")
 		},
 		DNSDone: func(dnsInfo httptrace.DNSDoneInfo) {
+			t.observe(ClientTracePhaseDNS, t.started(&t.dnsStart))
 			addrs := make([]string, 0, len(dnsInfo.Addrs))
 			for _, each := range dnsInfo.Addrs {
 				addrs = append(addrs, each.IP.String())
@@ -58,48 +133,85 @@ func BuildClientTrace(ctx context.Context) *httptrace.ClientTrace {
 			logger := log.WithField("addrs", addrs).
 				WithField("Coalesced", dnsInfo.Coalesced)
 			if dnsInfo.Err != nil {
-				logger.ErrorContext(ctx, dnsInfo.Err)
+				logger.WithError(dnsInfo.Err).DebugContext(ctx, "DNSDone")
 			} else {
-				logger.InfoContext(ctx, "DNSDone")
+				logger.DebugContext(ctx, "DNSDone")
 			}
 		},
 		ConnectStart: func(network, addr string) {
+			t.mark(&t.connectStart)
 			log.WithField("network", network).
 				WithField("addr", addr).
-				InfoContext(ctx, "ConnectStart")
+				DebugContext(ctx, "ConnectStart")
 		},
 		ConnectDone: func(network, addr string, err error) {
+			t.observe(ClientTracePhaseConnect, t.started(&t.connectStart))
 			logger := log.WithField("network", network).
 				WithField("addr", addr)
 			if err != nil {
-				logger.ErrorContext(ctx, err)
+				logger.WithError(err).DebugContext(ctx, "ConnectDone")
 			} else {
-				logger.InfoContext(ctx, "ConnectStart")
+				logger.DebugContext(ctx, "ConnectDone")
 			}
 		},
 		TLSHandshakeStart: func() {
-			log.InfoContext(ctx, "TLSHandshakeStart")
+			t.mark(&t.tlsStart)
+			log.DebugContext(ctx, "TLSHandshakeStart")
 		},
-		TLSHandshakeDone: func(cs tls.ConnectionState, e error) {
-			log.InfoContext(ctx, "TLSHandshakeDone")
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			t.observe(ClientTracePhaseTLS, t.started(&t.tlsStart))
+			if err != nil {
+				log.WithError(err).DebugContext(ctx, "TLSHandshakeDone")
+			} else {
+				log.DebugContext(ctx, "TLSHandshakeDone")
+			}
 		},
 		WroteHeaderField: func(key string, value []string) {
 			log.WithField("key", key).
 				WithField("value", value).
-				InfoContext(ctx, "WroteHeaderField")
+				DebugContext(ctx, "WroteHeaderField")
 		},
 		WroteHeaders: func() {
-			log.InfoContext(ctx, "WroteHeaders")
+			log.DebugContext(ctx, "WroteHeaders")
 		},
 		Wait100Continue: func() {
-			log.InfoContext(ctx, "Wait100Continue")
+			log.DebugContext(ctx, "Wait100Continue")
 		},
 		WroteRequest: func(wri httptrace.WroteRequestInfo) {
 			if wri.Err != nil {
-				log.ErrorContext(ctx, wri.Err)
+				log.WithError(wri.Err).DebugContext(ctx, "WroteRequest")
 			} else {
-				log.InfoContext(ctx, "WroteRequest")
+				log.DebugContext(ctx, "WroteRequest")
 			}
 		},
 	}
 }
+
+// ClientTraceMiddleware 为每个请求挂上BuildClientTrace,并在响应body关闭时统计总耗时
+func ClientTraceMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		timings := newClientTimings(ctx, req.URL.Host)
+		req = req.WithContext(httptrace.WithClientTrace(ctx, timings.clientTrace()))
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			timings.observe(ClientTracePhaseTotal, timings.start)
+			return nil, errorsx.Trace(err)
+		}
+		resp.Body = &timedBody{ReadCloser: resp.Body, timings: timings}
+		return resp, nil
+	})
+}
+
+type timedBody struct {
+	io.ReadCloser
+	timings *clientTimings
+	once    sync.Once
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(func() {
+		b.timings.observe(ClientTracePhaseTotal, b.timings.start)
+	})
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,51 @@
+package httpx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+func TestClientTraceMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	srvURL, _ := url.Parse(srv.URL)
+	client := httpx.MakeClient(&httpx.ClientConf{
+		TransportConf: &httpx.TransportConf{
+			Middlewares: []string{httpx.ClientTraceMiddlewareName},
+		},
+	})
+	if _, err := httpx.NewRequest(http.MethodGet, srv.URL, httpx.WithClient(client)).
+		Do(context.TODO(), nil); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	phases := make(map[string]bool)
+	for _, family := range families {
+		if family.GetName() != "httpx_client_trace_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["host"] == srvURL.Host {
+				phases[labels["phase"]] = true
+			}
+		}
+	}
+	for _, phase := range []string{httpx.ClientTracePhaseConnect, httpx.ClientTracePhaseTTFB, httpx.ClientTracePhaseTotal} {
+		if !phases[phase] {
+			t.Fatalf("expected:%s,got:%v", phase, phases)
+		}
+	}
+}
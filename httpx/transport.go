@@ -1,7 +1,6 @@
 package httpx
 
 import (
-	"bytes"
 	"context"
 	"io"
 	"io/ioutil"
@@ -11,10 +10,10 @@ import (
 	"time"
 
 	"github.com/wwq-2020/go.common/bus"
+	"github.com/wwq-2020/go.common/confx"
 	"github.com/wwq-2020/go.common/errorsx"
 	"github.com/wwq-2020/go.common/log"
-	"github.com/wwq-2020/go.common/stack"
-	"github.com/wwq-2020/go.common/tracing"
+	"github.com/wwq-2020/go.common/syncx"
 	"github.com/wwq-2020/go.common/util"
 )
 
@@ -43,6 +42,8 @@ var (
 	DefaultReadBufferSize            = 1 << 12
 	DefaultReadBufferSizeStr         = util.ToByteStr(int64(DefaultReadBufferSize))
 	DefaultForceAttemptHTTP2         = false
+	maxLogBodySize                   = int64(1 << 12)
+	closeIdleGrace                   = 30 * time.Second
 )
 
 // DefaultTransport DefaultTransport
@@ -54,76 +55,73 @@ type retriableTransport struct {
 	maxRetry   int
 	rt         http.RoundTripper
 	retryCheck RetryCheck
+	policy     *retryPolicy
 }
 
-func (rt *retriableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	var saved []byte
-	var err error
-	ctx := req.Context()
-	stack := stack.New()
-	stack.Set("httpmethod", req.Method).
-		Set("url", req.URL.String())
-	span, ctx := tracing.StartSpan(ctx, "RoundTrip")
-	defer span.FinishWithFields(&err, stack)
-	req = req.WithContext(ctx)
-	span.InjectToHTTPReq(req)
-	if req.Body != nil {
-		saved, err = ioutil.ReadAll(req.Body)
-		if err != nil {
-			return nil, errorsx.Trace(err)
+// RetryMiddleware RetryMiddleware
+func RetryMiddleware(maxRetry int, retryCheck RetryCheck, policy *RetryPolicy) RoundTripperMiddleware {
+	if retryCheck == nil {
+		retryCheck = DefaultRetryCheck
+	}
+	retryPolicy := buildRetryPolicy(policy)
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &retriableTransport{
+			rt:         rt,
+			maxRetry:   maxRetry,
+			retryCheck: retryCheck,
+			policy:     retryPolicy,
 		}
-		stack.Set("reqBody", string(saved))
 	}
-	start := time.Now()
-	stack.Set("invokeStart", start.Format("2006-01-02 15:04:05"))
+}
 
+func (rt *retriableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	retryable := rt.policy.retryable(req)
 	var resp *http.Response
-	for i := 0; i < rt.maxRetry; i++ {
-		curTime := time.Now()
-		stack.Set("curTime", curTime.Format("2006-01-02 15:04:05"))
-		stack.Set("retries", i)
-		log.WithFields(stack).
-			InfoContext(ctx, "start invoke")
-		req.Body = io.NopCloser(bytes.NewBuffer(saved))
+	var err error
+	for i := 0; ; i++ {
+		if i > 0 {
+			log.WithField("retries", i).
+				WithField("url", req.URL.String()).
+				DebugContext(ctx, "retry invoke")
+		}
+		if i > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errorsx.Trace(err)
+			}
+			req.Body = body
+		}
 		resp, err = rt.rt.RoundTrip(req)
-		retry := rt.retryCheck(req, resp, err)
-		if retry {
-			time.Sleep(time.Millisecond * 100)
-			continue
+		if !retryable || i+1 >= rt.maxRetry || !rt.retryCheck(req, resp, err) {
+			break
 		}
-		if err != nil {
-			return nil, errorsx.Trace(err)
+		wait, ok := rt.policy.backoff(i, resp)
+		if !ok {
+			break
 		}
-		goto end
-	}
-end:
-	if resp != nil {
-		respData, respBody, err := DrainBody(resp.Body)
-		if err != nil {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			break
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			resp = nil
+		}
+		if err := sleepContext(ctx, wait); err != nil {
 			return nil, errorsx.Trace(err)
 		}
-		resp.Body = respBody
-
-		end := time.Now()
-		elapsed := end.Sub(start).Milliseconds()
-		respDataStr := string(respData)
-		stack.Set("respData", respDataStr).
-			Set("elapsed", elapsed).
-			Set("httpStatusCode", resp.StatusCode).
-			Set("invokeFinish", end.Format("2006-01-02 15:04:05"))
-		log.WithField("respData", respDataStr).
-			WithField("elapsed", elapsed).
-			WithField("httpStatusCode", resp.StatusCode).
-			WithField("invokeFinish", end.Format("2006-01-02 15:04:05")).
-			InfoContext(ctx, "invoke finish")
-		return resp, nil
-	}
-	return nil, errorsx.Trace(err)
+	}
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	return resp, nil
 }
 
 // DefaultRetryCheck DefaultRetryCheck
 func DefaultRetryCheck(req *http.Request, resp *http.Response, err error) bool {
-	return err != nil || (resp != nil && resp.StatusCode >= http.StatusInternalServerError)
+	return err != nil || (resp != nil &&
+		(resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests))
 }
 
 // RetryCheck RetryCheck
@@ -140,22 +138,40 @@ var defaultTransportOptions = TransportOptions{
 
 // TransportConf TransportConf
 type TransportConf struct {
-	MaxRetry               *int    `toml:"max_retry" yaml:"max_retry" json:"max_retry"`
-	DialTimeout            *string `toml:"dial_timeout" yaml:"dial_timeout" json:"dial_timeout"`
-	KeepAlive              *string `toml:"keepalive" yaml:"keepalive" json:"keepalive"`
-	DisableKeepAlives      *bool   `toml:"disable_keep_alives" yaml:"disable_keep_alives" json:"disable_keep_alives"`
-	DisableCompression     *bool   `toml:"disable_compression" yaml:"disable_compression" json:"disable_compression"`
-	MaxIdleConns           *int    `toml:"max_idle_conns" yaml:"max_idle_conns" json:"max_idle_conns"`
-	MaxIdleConnsPerHost    *int    `toml:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
-	MaxConnsPerHost        *int    `toml:"max_conns_per_host" yaml:"max_conns_per_host" json:"max_conns_per_host"`
-	IdleConnTimeout        *string `toml:"idle_conn_timeout" yaml:"idle_conn_timeout" json:"idle_conn_timeout"`
-	ResponseHeaderTimeout  *string `toml:"response_header_timeout" yaml:"response_header_timeout" json:"response_header_timeout"`
-	ExpectContinueTimeout  *string `toml:"expect_continue_timeout" yaml:"expect_continue_timeout" json:"expect_continue_timeout"`
-	MaxResponseHeaderBytes *string `toml:"max_response_header_bytes" yaml:"max_response_header_bytes" json:"max_response_header_bytes"`
-	WriteBufferSize        *string `toml:"write_buffer_size" yaml:"write_buffer_size" json:"write_buffer_size"`
-	ReadBufferSize         *string `toml:"read_buffer_size" yaml:"read_buffer_size" json:"read_buffer_size"`
-	ForceAttemptHTTP2      *bool   `toml:"force_attempt_http2" yaml:"force_attempt_http2" json:"force_attempt_http2"`
-	RetryCheck             RetryCheck
+	MaxRetry               *int                   `toml:"max_retry" yaml:"max_retry" json:"max_retry"`
+	DialTimeout            *string                `toml:"dial_timeout" yaml:"dial_timeout" json:"dial_timeout"`
+	KeepAlive              *string                `toml:"keepalive" yaml:"keepalive" json:"keepalive"`
+	DisableKeepAlives      *bool                  `toml:"disable_keep_alives" yaml:"disable_keep_alives" json:"disable_keep_alives"`
+	DisableCompression     *bool                  `toml:"disable_compression" yaml:"disable_compression" json:"disable_compression"`
+	MaxIdleConns           *int                   `toml:"max_idle_conns" yaml:"max_idle_conns" json:"max_idle_conns"`
+	MaxIdleConnsPerHost    *int                   `toml:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
+	MaxConnsPerHost        *int                   `toml:"max_conns_per_host" yaml:"max_conns_per_host" json:"max_conns_per_host"`
+	IdleConnTimeout        *string                `toml:"idle_conn_timeout" yaml:"idle_conn_timeout" json:"idle_conn_timeout"`
+	ResponseHeaderTimeout  *string                `toml:"response_header_timeout" yaml:"response_header_timeout" json:"response_header_timeout"`
+	ExpectContinueTimeout  *string                `toml:"expect_continue_timeout" yaml:"expect_continue_timeout" json:"expect_continue_timeout"`
+	MaxResponseHeaderBytes *string                `toml:"max_response_header_bytes" yaml:"max_response_header_bytes" json:"max_response_header_bytes"`
+	WriteBufferSize        *string                `toml:"write_buffer_size" yaml:"write_buffer_size" json:"write_buffer_size"`
+	ReadBufferSize         *string                `toml:"read_buffer_size" yaml:"read_buffer_size" json:"read_buffer_size"`
+	ForceAttemptHTTP2      *bool                  `toml:"force_attempt_http2" yaml:"force_attempt_http2" json:"force_attempt_http2"`
+	RetryPolicy            *RetryPolicy           `toml:"retry_policy" yaml:"retry_policy" json:"retry_policy" nullable:"true"`
+	Breaker                *BreakerConf           `toml:"breaker" yaml:"breaker" json:"breaker" nullable:"true"`
+	Bulkhead               *BulkheadConf          `toml:"bulkhead" yaml:"bulkhead" json:"bulkhead" nullable:"true"`
+	Cache                  *CacheConf             `toml:"cache" yaml:"cache" json:"cache" nullable:"true"`
+	RateLimit              *RateLimitConf         `toml:"ratelimit" yaml:"ratelimit" json:"ratelimit" nullable:"true"`
+	OAuth2                 *ClientCredentialsConf `toml:"oauth2" yaml:"oauth2" json:"oauth2" nullable:"true"`
+	// Proxy 代理地址,支持http、https、socks5,env表示读取环境变量
+	Proxy *string `toml:"proxy" yaml:"proxy" json:"proxy" nullable:"true"`
+	// NoProxy 不走代理的host列表,逗号分隔,规则同NO_PROXY
+	NoProxy *string `toml:"no_proxy" yaml:"no_proxy" json:"no_proxy" nullable:"true"`
+	// HostOverrides host或host:port到ip、ip:port或unix:///path的静态映射
+	HostOverrides map[string]string `toml:"host_overrides" yaml:"host_overrides" json:"host_overrides" nullable:"true"`
+	// DNSCacheTTL 非空时缓存dns解析结果
+	DNSCacheTTL *string `toml:"dns_cache_ttl" yaml:"dns_cache_ttl" json:"dns_cache_ttl" nullable:"true"`
+	// Middlewares 按顺序组合的内置中间件名,第一个在最外层
+	Middlewares []string   `toml:"middlewares" yaml:"middlewares" json:"middlewares" nullable:"true"`
+	RetryCheck  RetryCheck `toml:"-" yaml:"-" json:"-"`
+	// RoundTripperMiddlewares 非空时代替Middlewares
+	RoundTripperMiddlewares []RoundTripperMiddleware `toml:"-" yaml:"-" json:"-"`
 }
 
 func (c *TransportConf) fill() {
@@ -204,6 +220,10 @@ func (c *TransportConf) fill() {
 	if c.ForceAttemptHTTP2 == nil {
 		c.ForceAttemptHTTP2 = &DefaultForceAttemptHTTP2
 	}
+	if c.RetryPolicy == nil {
+		c.RetryPolicy = defaultRetryPolicy
+	}
+	c.RetryPolicy.fill()
 	if c.RetryCheck == nil {
 		c.RetryCheck = DefaultRetryCheck
 	}
@@ -226,6 +246,7 @@ var (
 		WriteBufferSize:        &DefaultWriteBufferSizeStr,
 		ReadBufferSize:         &DefaultReadBufferSizeStr,
 		ForceAttemptHTTP2:      &DefaultForceAttemptHTTP2,
+		RetryPolicy:            defaultRetryPolicy,
 		RetryCheck:             DefaultRetryCheck,
 	}
 )
@@ -282,15 +303,31 @@ func MakeTransport(transportConf *TransportConf) http.RoundTripper {
 		log.WithField("keepalive", transportConf.KeepAlive).
 			Error(err)
 	}
-	rt.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
-		log.WithField("network", network).
-			WithField("address", address).
-			DebugContext(ctx, "dial")
-		conn, err := dialer.DialContext(ctx, network, address)
+	var cache *dnsCache
+	if transportConf.DNSCacheTTL != nil && *transportConf.DNSCacheTTL != "" {
+		dnsCacheTTL, err := time.ParseDuration(*transportConf.DNSCacheTTL)
+		if err == nil && dnsCacheTTL > 0 {
+			cache = newDNSCache(dnsCacheTTL)
+		}
 		if err != nil {
-			return nil, errorsx.Trace(err)
+			log.WithField("dns_cache_ttl", transportConf.DNSCacheTTL).
+				Error(err)
+		}
+	}
+	rt.DialContext = makeDialContext(dialer, transportConf.HostOverrides, cache)
+	if transportConf.Proxy != nil {
+		noProxy := ""
+		if transportConf.NoProxy != nil {
+			noProxy = *transportConf.NoProxy
+		}
+		proxy, err := makeProxy(*transportConf.Proxy, noProxy)
+		if err == nil {
+			rt.Proxy = proxy
+		}
+		if err != nil {
+			log.WithField("proxy", transportConf.Proxy).
+				Error(err)
 		}
-		return conn, nil
 	}
 
 	if transportConf.DisableKeepAlives != nil {
@@ -361,17 +398,74 @@ func MakeTransport(transportConf *TransportConf) http.RoundTripper {
 		rt.ForceAttemptHTTP2 = *transportConf.ForceAttemptHTTP2
 	}
 
-	return &retriableTransport{
-		rt:         rt,
-		maxRetry:   *transportConf.MaxRetry,
-		retryCheck: transportConf.RetryCheck,
+	middleware := buildRoundTripperMiddleware(transportConf)
+	return &idleClosableTransport{
+		RoundTripper: middleware(rt),
+		transport:    rt,
+	}
+}
+
+// idleClosableTransport 中间件包装后仍可关闭底层连接池的空闲连接
+type idleClosableTransport struct {
+	http.RoundTripper
+	transport *http.Transport
+}
+
+// CloseIdleConnections CloseIdleConnections
+func (t *idleClosableTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
+
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// WatchTransport 将source中keyPath处的TransportConf绑定到可变transport
+func WatchTransport(ctx context.Context, source confx.Source, keyPath string) (http.RoundTripper, error) {
+	confs, err := confx.Watch(ctx, source, keyPath, func() interface{} {
+		return &TransportConf{}
+	})
+	if err != nil {
+		return nil, errorsx.Trace(err)
 	}
+	ch := make(chan *TransportConf)
+	syncx.SafeGo(func() {
+		defer close(ch)
+		for conf := range confs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- conf.(*TransportConf):
+			}
+		}
+	})
+	return MakeChangableTransport(ctx, ch), nil
 }
 
 type changableTransport struct {
 	rt atomic.Value
 }
 
+// store 替换transport,旧transport的空闲连接立即关闭,进行中的连接在closeIdleGrace后再次关闭
+func (ct *changableTransport) store(transport http.RoundTripper) {
+	old, _ := ct.rt.Load().(http.RoundTripper)
+	ct.rt.Store(transport)
+	if old == nil {
+		return
+	}
+	closeIdleConnections(old)
+	time.AfterFunc(closeIdleGrace, func() {
+		closeIdleConnections(old)
+	})
+}
+
+// CloseIdleConnections CloseIdleConnections
+func (ct *changableTransport) CloseIdleConnections() {
+	closeIdleConnections(ct.rt.Load().(http.RoundTripper))
+}
+
 func (ct *changableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	resp, err := ct.rt.Load().(http.RoundTripper).RoundTrip(req)
 	if err != nil {
@@ -385,11 +479,11 @@ func MakeChangableTransport(ctx context.Context, ch <-chan *TransportConf) http.
 	ct := &changableTransport{}
 	callback := func(transportConf *TransportConf) {
 		transport := MakeTransport(transportConf)
-		ct.rt.Store(transport)
+		ct.store(transport)
 	}
 	transportConf := <-ch
 	callback(transportConf)
-	bus.SubscribeChans(ctx, ch, callback)
+	bus.SubscribeChansContext(ctx, callback, ch)
 	return ct
 }
 
@@ -397,10 +491,10 @@ func MakeChangableTransport(ctx context.Context, ch <-chan *TransportConf) http.
 func ChangableTransport(ctx context.Context, ch <-chan http.RoundTripper) http.RoundTripper {
 	ct := &changableTransport{}
 	callback := func(transport http.RoundTripper) {
-		ct.rt.Store(transport)
+		ct.store(transport)
 	}
 	transport := <-ch
 	callback(transport)
-	bus.SubscribeChans(ctx, ch, callback)
+	bus.SubscribeChansContext(ctx, callback, ch)
 	return ct
 }
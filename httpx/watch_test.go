@@ -0,0 +1,78 @@
+package httpx_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/confx"
+	"github.com/wwq-2020/go.common/httpx"
+)
+
+const transportConfTpl = `
+[client.transport]
+max_retry = 0
+dial_timeout = "1s"
+keepalive = "30s"
+disable_keep_alives = false
+disable_compression = false
+max_idle_conns = 10
+max_idle_conns_per_host = 10
+max_conns_per_host = 10
+idle_conn_timeout = "30s"
+response_header_timeout = "1s"
+expect_continue_timeout = "1s"
+max_response_header_bytes = "4KB"
+write_buffer_size = "4KB"
+read_buffer_size = "4KB"
+force_attempt_http2 = false
+[client.transport.host_overrides]
+"svc.test" = "%s"
+`
+
+func TestWatchTransport(t *testing.T) {
+	srvA := httptest.NewServer(&srv{normalResp: "a"})
+	defer srvA.Close()
+	srvB := httptest.NewServer(&srv{normalResp: "b"})
+	defer srvB.Close()
+	file := filepath.Join(t.TempDir(), "conf.toml")
+	writeConf := func(srvURL string) {
+		u, _ := url.Parse(srvURL)
+		data := []byte(fmt.Sprintf(transportConfTpl, u.Host))
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatalf("expected:%v,got:%v", nil, err)
+		}
+	}
+	writeConf(srvA.URL)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	transport, err := httpx.WatchTransport(ctx, confx.NewFileSource(file, 10*time.Millisecond), "client.transport")
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	client := &http.Client{Transport: transport}
+	get := func() string {
+		resp := &resp{}
+		if err := httpx.Get(context.TODO(), "http://svc.test/", resp, httpx.WithClient(client)); err != nil {
+			t.Fatalf("expected:%v,got:%v", nil, err)
+		}
+		return resp.Data
+	}
+	if data := get(); data != "a" {
+		t.Fatalf("expected:%s,got:%s", "a", data)
+	}
+	writeConf(srvB.URL)
+	for i := 0; i < 200; i++ {
+		if get() == "b" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected transport reloaded")
+}
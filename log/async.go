@@ -0,0 +1,338 @@
+package log
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"go.uber.org/zap/zapcore"
+)
+
+// errs
+var (
+	ErrAsyncOutputClosed = errorsx.Std("async output closed")
+)
+
+// OverflowPolicy 缓冲区满时的处理策略
+type OverflowPolicy string
+
+// OverflowPolicys
+const (
+	// OverflowBlock 阻塞直到有空位
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDropNewest 丢弃新写入的日志
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowDropLowLevel 优先丢弃debug/info日志,缓冲区内全是warn及以上时阻塞
+	OverflowDropLowLevel OverflowPolicy = "drop_low_level"
+)
+
+// vars
+var (
+	DefaultAsyncBufferSize    = 8192
+	DefaultAsyncOverflow      = OverflowBlock
+	DefaultAsyncFlushInterval = time.Second
+)
+
+// AsyncConf AsyncConf
+type AsyncConf struct {
+	BufferSize    int            `toml:"buffer_size" yaml:"buffer_size" json:"buffer_size" nullable:"true"`
+	Overflow      OverflowPolicy `toml:"overflow" yaml:"overflow" json:"overflow" nullable:"true"`
+	FlushInterval string         `toml:"flush_interval" yaml:"flush_interval" json:"flush_interval" nullable:"true"`
+}
+
+func (c *AsyncConf) fill() {
+	if c.BufferSize <= 0 {
+		c.BufferSize = DefaultAsyncBufferSize
+	}
+	if c.Overflow != OverflowBlock &&
+		c.Overflow != OverflowDropNewest &&
+		c.Overflow != OverflowDropLowLevel {
+		c.Overflow = DefaultAsyncOverflow
+	}
+	if c.FlushInterval == "" {
+		c.FlushInterval = DefaultAsyncFlushInterval.String()
+	}
+}
+
+// levelWriter 带日志级别写入,供按级别丢弃
+type levelWriter interface {
+	WriteLevel(zapcore.Level, []byte) (int, error)
+}
+
+type asyncEntry struct {
+	level zapcore.Level
+	data  []byte
+}
+
+// AsyncOutput 异步输出,写入进入有界环形缓冲区,由后台goroutine写到output
+type AsyncOutput struct {
+	output        io.WriteCloser
+	overflow      OverflowPolicy
+	flushInterval time.Duration
+	entries       []asyncEntry
+	head          int
+	count         int
+	writing       int
+	dropped       uint64
+	closed        bool
+	notify        chan struct{}
+	exited        chan struct{}
+	mu            sync.Mutex
+	notFull       *sync.Cond
+	drained       *sync.Cond
+	closeOnce     sync.Once
+}
+
+// NewAsyncOutput NewAsyncOutput
+func NewAsyncOutput(output io.WriteCloser, conf *AsyncConf) *AsyncOutput {
+	if conf == nil {
+		conf = &AsyncConf{}
+	}
+	conf.fill()
+	flushInterval, err := time.ParseDuration(conf.FlushInterval)
+	if err != nil || flushInterval <= 0 {
+		flushInterval = DefaultAsyncFlushInterval
+	}
+	if err != nil {
+		WithField("flush_interval", conf.FlushInterval).
+			Error(errorsx.Trace(err))
+	}
+	a := &AsyncOutput{
+		output:        output,
+		overflow:      conf.Overflow,
+		flushInterval: flushInterval,
+		entries:       make([]asyncEntry, conf.BufferSize),
+		notify:        make(chan struct{}, 1),
+		exited:        make(chan struct{}),
+	}
+	a.notFull = sync.NewCond(&a.mu)
+	a.drained = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// Write 不带级别的写入按warn处理,drop_low_level策略下不会优先丢弃
+func (a *AsyncOutput) Write(b []byte) (int, error) {
+	return a.WriteLevel(zapcore.WarnLevel, b)
+}
+
+// WriteLevel WriteLevel
+func (a *AsyncOutput) WriteLevel(level zapcore.Level, b []byte) (int, error) {
+	data := make([]byte, len(b))
+	copy(data, b)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for !a.closed && a.count == len(a.entries) {
+		if a.overflow == OverflowDropNewest ||
+			(a.overflow == OverflowDropLowLevel && isLowLevel(level)) {
+			a.drop(level)
+			return len(b), nil
+		}
+		if a.overflow == OverflowDropLowLevel && a.evictLowLevel() {
+			break
+		}
+		a.wakeup()
+		a.notFull.Wait()
+	}
+	if a.closed {
+		return 0, errorsx.Trace(ErrAsyncOutputClosed)
+	}
+	a.entries[(a.head+a.count)%len(a.entries)] = asyncEntry{level: level, data: data}
+	a.count++
+	a.wakeup()
+	return len(b), nil
+}
+
+func isLowLevel(level zapcore.Level) bool {
+	return level <= zapcore.InfoLevel
+}
+
+// evictLowLevel 丢弃缓冲区内最早的一条debug/info日志
+func (a *AsyncOutput) evictLowLevel() bool {
+	size := len(a.entries)
+	for i := 0; i < a.count; i++ {
+		idx := (a.head + i) % size
+		level := a.entries[idx].level
+		if !isLowLevel(level) {
+			continue
+		}
+		for j := i; j < a.count-1; j++ {
+			a.entries[(a.head+j)%size] = a.entries[(a.head+j+1)%size]
+		}
+		a.count--
+		a.entries[(a.head+a.count)%size] = asyncEntry{}
+		a.drop(level)
+		return true
+	}
+	return false
+}
+
+func (a *AsyncOutput) drop(level zapcore.Level) {
+	a.dropped++
+	asyncDropped.WithLabelValues(level.String()).Inc()
+}
+
+func (a *AsyncOutput) wakeup() {
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Dropped 累计丢弃的日志条数
+func (a *AsyncOutput) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+func (a *AsyncOutput) run() {
+	defer close(a.exited)
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.notify:
+		case <-ticker.C:
+			a.flush()
+			if err := a.syncOutput(); err != nil {
+				reportError("async", "failed to sync async output", err)
+			}
+		}
+		a.flush()
+		a.mu.Lock()
+		exit := a.closed && a.count == 0
+		a.mu.Unlock()
+		if exit {
+			return
+		}
+	}
+}
+
+// flush 取出缓冲区内的全部日志写到output,写的过程中不持有锁
+func (a *AsyncOutput) flush() {
+	a.mu.Lock()
+	batch := make([]asyncEntry, a.count)
+	for i := range batch {
+		idx := (a.head + i) % len(a.entries)
+		batch[i] = a.entries[idx]
+		a.entries[idx] = asyncEntry{}
+	}
+	a.head = 0
+	a.count = 0
+	a.writing = len(batch)
+	a.notFull.Broadcast()
+	a.mu.Unlock()
+
+	for _, entry := range batch {
+		if _, err := a.output.Write(entry.data); err != nil {
+			reportError("async", "failed to write async output", err)
+		}
+	}
+
+	a.mu.Lock()
+	a.writing = 0
+	a.drained.Broadcast()
+	a.mu.Unlock()
+}
+
+func (a *AsyncOutput) syncOutput() error {
+	syncer, ok := a.output.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+	if err := syncer.Sync(); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+// Sync 等待缓冲区内的日志全部写出后sync output
+func (a *AsyncOutput) Sync() error {
+	a.mu.Lock()
+	for !a.closed && (a.count > 0 || a.writing > 0) {
+		a.wakeup()
+		a.drained.Wait()
+	}
+	closed := a.closed
+	a.mu.Unlock()
+	if closed {
+		<-a.exited
+	}
+	return a.syncOutput()
+}
+
+// Close 写出缓冲区内的全部日志后关闭output
+func (a *AsyncOutput) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		a.mu.Lock()
+		a.closed = true
+		a.notFull.Broadcast()
+		a.drained.Broadcast()
+		a.wakeup()
+		a.mu.Unlock()
+		<-a.exited
+		if syncErr := a.syncOutput(); syncErr != nil {
+			err = syncErr
+		}
+		if closeErr := a.output.Close(); closeErr != nil && err == nil {
+			err = errorsx.Trace(closeErr)
+		}
+	})
+	return err
+}
+
+// levelCore 与zapcore.ioCore一致,只是带日志级别写入levelWriter
+type levelCore struct {
+	zapcore.LevelEnabler
+	enc zapcore.Encoder
+	out levelWriter
+}
+
+func newLevelCore(enc zapcore.Encoder, out levelWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return &levelCore{LevelEnabler: enab, enc: enc, out: out}
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &levelCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), out: c.out}
+	for i := range fields {
+		fields[i].AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *levelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	_, err = c.out.WriteLevel(ent.Level, buf.Bytes())
+	buf.Free()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if ent.Level > zapcore.ErrorLevel {
+		return c.Sync()
+	}
+	return nil
+}
+
+func (c *levelCore) Sync() error {
+	syncer, ok := c.out.(interface{ Sync() error })
+	if !ok {
+		return nil
+	}
+	if err := syncer.Sync(); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package log_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+)
+
+type gateOutput struct {
+	gate chan struct{}
+	buf  bytes.Buffer
+	sync.Mutex
+}
+
+func (o *gateOutput) Write(b []byte) (int, error) {
+	<-o.gate
+	o.Lock()
+	defer o.Unlock()
+	return o.buf.Write(b)
+}
+
+func (o *gateOutput) Close() error {
+	return nil
+}
+
+func (o *gateOutput) String() string {
+	o.Lock()
+	defer o.Unlock()
+	return o.buf.String()
+}
+
+func TestAsyncOutputFlushOnClose(t *testing.T) {
+	output := &gateOutput{gate: make(chan struct{})}
+	close(output.gate)
+	logger := log.New(log.WithAsyncOutput(output, nil))
+	for i := 0; i < 100; i++ {
+		logger.Info("hello")
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if got := strings.Count(output.String(), "hello"); got != 100 {
+		t.Fatalf("expected:%d,got:%d", 100, got)
+	}
+}
+
+func TestAsyncOutputDropLowLevel(t *testing.T) {
+	output := &gateOutput{gate: make(chan struct{})}
+	async := log.NewAsyncOutput(output, &log.AsyncConf{
+		BufferSize: 4,
+		Overflow:   log.OverflowDropLowLevel,
+	})
+	logger := log.New(log.WithOutput(async))
+	logger.SetLevel(log.DebugLevel)
+	// output阻塞,后台goroutine最多取走一条
+	logger.Info("first")
+	for i := 0; i < 10; i++ {
+		logger.Debug("noise")
+	}
+	logger.Error(errorString("important"))
+	close(output.gate)
+	if err := async.Close(); err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	if dropped := async.Dropped(); dropped == 0 {
+		t.Fatalf("expected:%s,got:%d", "dropped > 0", dropped)
+	}
+	if !strings.Contains(output.String(), "important") {
+		t.Fatalf("expected:%s,got:%s", "important", output.String())
+	}
+}
+
+type errorString string
+
+func (e errorString) Error() string {
+	return string(e)
+}
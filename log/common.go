@@ -7,7 +7,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/wwq-2020/go.common/errorsx"
 	"github.com/wwq-2020/go.common/stack"
 	"go.uber.org/zap"
 )
@@ -78,18 +77,87 @@ func GenTraceID() string {
 	return fmt.Sprintf("%d.%d.%d", timestamp, pid, atomic.AddUint64(&seq, 1))
 }
 
-// DupContext DupContext
+// DupContext 复制logger,traceID与字段集合到新的context,用于后台goroutine
 func DupContext(ctx context.Context) context.Context {
 	logger := LoggerFromContext(ctx)
 	traceID := TraceIDFromContext(ctx)
-	ctx = ContextWithLogger(context.TODO(), logger)
-	return ContextWithTraceID(ctx, traceID)
+	fields := fieldsFromContext(ctx)
+	dupCtx := ContextWithLogger(context.TODO(), logger)
+	dupCtx = ContextWithTraceID(dupCtx, traceID)
+	if fields != nil {
+		dupCtx = context.WithValue(dupCtx, contextFieldsKey{}, fields)
+	}
+	return dupCtx
+}
+
+type contextFieldsKey struct{}
+
+// ContextWithFields 合并fields到ctx的字段集合,*Context方法会自动带上这些字段
+func ContextWithFields(ctx context.Context, fields stack.Fields) context.Context {
+	merged := stack.New()
+	if existing := fieldsFromContext(ctx); existing != nil {
+		merged = merged.Merge(existing)
+	}
+	return context.WithValue(ctx, contextFieldsKey{}, merged.Merge(fields))
+}
+
+// ContextWithField ContextWithField
+func ContextWithField(ctx context.Context, key string, val interface{}) context.Context {
+	return ContextWithFields(ctx, stack.New().Set(key, val))
+}
+
+// FieldsFromContext 返回字段集合的副本
+func FieldsFromContext(ctx context.Context) stack.Fields {
+	fields := stack.New()
+	if existing := fieldsFromContext(ctx); existing != nil {
+		fields = fields.Merge(existing)
+	}
+	return fields
+}
+
+func fieldsFromContext(ctx context.Context) stack.Fields {
+	fieldsObj := ctx.Value(contextFieldsKey{})
+	if fieldsObj == nil {
+		return nil
+	}
+	return fieldsObj.(stack.Fields)
 }
 
-func zapFieldsFromContext(ctx context.Context) []zap.Field {
-	return []zap.Field{
+// zapFieldsFromContext ctx中的字段优先级低于logger上显式设置的同名字段
+func (l *logger) zapFieldsFromContext(ctx context.Context) []zap.Field {
+	zapFields := []zap.Field{
 		zap.String("traceID", TraceIDFromContext(ctx)),
 	}
+	fields := fieldsFromContext(ctx)
+	if fields == nil {
+		return zapFields
+	}
+	for k, v := range fields.KVs() {
+		if _, exist := l.fieldKeys[k]; exist {
+			continue
+		}
+		zapFields = append(zapFields, zap.Any(k, v))
+	}
+	return zapFields
+}
+
+func (l *logger) withFieldKeys(kvs map[string]interface{}) map[string]struct{} {
+	fieldKeys := make(map[string]struct{}, len(l.fieldKeys)+len(kvs))
+	for k := range l.fieldKeys {
+		fieldKeys[k] = struct{}{}
+	}
+	for k := range kvs {
+		fieldKeys[k] = struct{}{}
+	}
+	return fieldKeys
+}
+
+func (l *logger) withZapFieldKeys(fields []zap.Field) map[string]struct{} {
+	kvs := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		kvs[field.Key] = nil
+	}
+	return l.withFieldKeys(kvs)
 }
 
 func fields2ZapFields(fields stack.Fields) []zap.Field {
@@ -100,8 +168,3 @@ func fields2ZapFields(fields stack.Fields) []zap.Field {
 	}
 	return zapFields
 }
-
-func zapFieldsFromError(err error) []zap.Field {
-	fields := errorsx.FullFields(err)
-	return fields2ZapFields(fields)
-}
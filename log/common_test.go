@@ -0,0 +1,55 @@
+package log_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/stack"
+)
+
+func TestContextWithFields(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output))
+	ctx := log.ContextWithTraceID(context.Background(), "trace-1")
+	ctx = log.ContextWithFields(ctx, stack.New().Set("tenant", "t1"))
+	child := log.ContextWithField(ctx, "path", "/a")
+
+	logger.InfoContext(ctx, "parent")
+	logger.InfoContext(log.DupContext(child), "background")
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got:%v", lines)
+	}
+	if !strings.Contains(lines[0], `"tenant":"t1"`) || strings.Contains(lines[0], `"path"`) {
+		t.Fatalf("unexpected parent line:%s", lines[0])
+	}
+	for _, expected := range []string{`"traceID":"trace-1"`, `"tenant":"t1"`, `"path":"/a"`} {
+		if !strings.Contains(lines[1], expected) {
+			t.Fatalf("expected %s in dup context line:%s", expected, lines[1])
+		}
+	}
+}
+
+func TestContextFieldsExplicitWins(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output))
+	ctx := log.ContextWithFields(context.Background(), stack.New().
+		Set("httpmethod", "POST").
+		Set("path", "/a"))
+
+	logger.WithFields(stack.New().Set("httpmethod", "GET")).
+		WithField("path", "/b").
+		Dup().
+		InfoContext(ctx, "outgoing")
+	line := output.String()
+	for _, key := range []string{`"httpmethod"`, `"path"`} {
+		if got := strings.Count(line, key); got != 1 {
+			t.Fatalf("expected:%d,got:%d,line:%s", 1, got, line)
+		}
+	}
+	if !strings.Contains(line, `"httpmethod":"GET"`) || !strings.Contains(line, `"path":"/b"`) {
+		t.Fatalf("expected explicit fields to win, got:%s", line)
+	}
+}
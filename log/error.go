@@ -0,0 +1,120 @@
+package log
+
+import (
+	"github.com/wwq-2020/go.common/errcode"
+	"github.com/wwq-2020/go.common/errorsx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorFields 最外层的tip与fields平铺,完整的错误链放在errorChain中
+func (l *logger) errorFields(err error) []zap.Field {
+	causes := errorsx.Chain(err)
+	if len(causes) == 0 {
+		return nil
+	}
+	outermost := causes[0]
+	tip := outermost.Tip
+	if tip == "" {
+		tip = outermost.Message
+	}
+	fields := []zap.Field{zap.String("tip", tip)}
+	if outermost.Fields != nil {
+		fields = append(fields, fields2ZapFields(outermost.Fields)...)
+	}
+	withStack := !l.options.format.ErrorStackDebugOnly || l.effectiveLevel() == DebugLevel
+	return append(fields, zap.Array("errorChain", &errorChain{causes: causes, withStack: withStack}))
+}
+
+type errorChain struct {
+	causes    []*errorsx.Cause
+	withStack bool
+}
+
+// MarshalLogArray 与外层相同的调用栈只输出stackRef,与外层末尾相同的帧省略,只输出elidedFrames
+func (c *errorChain) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	seen := make(map[string]int, len(c.causes))
+	var outer []*errorsx.Frame
+	for i, cause := range c.causes {
+		obj := &errorCause{cause: cause, withStack: c.withStack, stackRef: -1}
+		if cause.Stack != "" {
+			if idx, exist := seen[cause.Stack]; exist {
+				obj.stackRef = idx
+			} else {
+				seen[cause.Stack] = i
+				frames := cause.Frames()
+				obj.elided = commonSuffix(frames, outer)
+				obj.frames = frames[:len(frames)-obj.elided]
+				outer = frames
+			}
+		}
+		if err := enc.AppendObject(obj); err != nil {
+			return errorsx.Trace(err)
+		}
+	}
+	return nil
+}
+
+func commonSuffix(frames, outer []*errorsx.Frame) int {
+	n := 0
+	for n < len(frames) && n < len(outer) &&
+		*frames[len(frames)-1-n] == *outer[len(outer)-1-n] {
+		n++
+	}
+	return n
+}
+
+type errorCause struct {
+	cause     *errorsx.Cause
+	withStack bool
+	stackRef  int
+	frames    []*errorsx.Frame
+	elided    int
+}
+
+func (c *errorCause) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	cause := c.cause
+	enc.AddString("msg", cause.Message)
+	if cause.Stack == "" {
+		return nil
+	}
+	if cause.Code != errcode.ErrCode_Unknown {
+		enc.AddString("code", cause.Code.String())
+	}
+	if cause.Tip != "" && cause.Tip != cause.Message {
+		enc.AddString("tip", cause.Tip)
+	}
+	if kvs := cause.Fields.KVs(); len(kvs) > 0 {
+		if err := enc.AddObject("fields", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			for key, val := range kvs {
+				zap.Any(key, val).AddTo(enc)
+			}
+			return nil
+		})); err != nil {
+			return errorsx.Trace(err)
+		}
+	}
+	if !c.withStack {
+		return nil
+	}
+	if c.stackRef >= 0 {
+		enc.AddInt("stackRef", c.stackRef)
+		return nil
+	}
+	if c.elided > 0 {
+		enc.AddInt("elidedFrames", c.elided)
+	}
+	return enc.AddArray("stack", zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		for _, frame := range c.frames {
+			if err := enc.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("function", frame.Function)
+				enc.AddString("file", frame.File)
+				enc.AddInt("line", frame.Line)
+				return nil
+			})); err != nil {
+				return errorsx.Trace(err)
+			}
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,107 @@
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/wwq-2020/go.common/errcode"
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+var errNotFound = errors.New("not found")
+
+type errorEntry struct {
+	Tip        string `json:"tip"`
+	User       string `json:"user"`
+	ErrorChain []struct {
+		Msg          string                 `json:"msg"`
+		Code         string                 `json:"code"`
+		Fields       map[string]interface{} `json:"fields"`
+		Stack        []errorsx.Frame        `json:"stack"`
+		StackRef     *int                   `json:"stackRef"`
+		ElidedFrames int                    `json:"elidedFrames"`
+	} `json:"errorChain"`
+}
+
+func findUser() error {
+	return errorsx.Trace(errNotFound).
+		WithCode(errcode.ErrCode_Unknown).
+		WithField("table", "user")
+}
+
+func hasFrame(frames []errorsx.Frame, function string) bool {
+	for _, frame := range frames {
+		if frame.Function == function && frame.Line > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func TestErrorChain(t *testing.T) {
+	err := errorsx.Trace(fmt.Errorf("load profile: %w", findUser())).
+		WithField("user", "u1")
+
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output))
+	logger.Error(err)
+	entry := &errorEntry{}
+	if err := json.Unmarshal(output.Bytes(), entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Tip != "load profile: not found" || entry.User != "u1" || len(entry.ErrorChain) != 2 {
+		t.Fatalf("unexpected entry:%s", output.String())
+	}
+	outer, inner := entry.ErrorChain[0], entry.ErrorChain[1]
+	if outer.Msg != "load profile: not found" || outer.Fields["user"] != "u1" || !hasFrame(outer.Stack, "TestErrorChain") {
+		t.Fatalf("unexpected outer cause:%+v", outer)
+	}
+	if inner.Msg != "not found" || inner.Fields["table"] != "user" || !hasFrame(inner.Stack, "findUser") {
+		t.Fatalf("unexpected inner cause:%+v", inner)
+	}
+}
+
+func wrapTwice() error {
+	inner := errorsx.New("inner")
+	return errorsx.Trace(fmt.Errorf("outer: %w", inner))
+}
+
+func TestErrorChainElidesFrames(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output))
+	logger.Error(wrapTwice())
+	entry := &errorEntry{}
+	if err := json.Unmarshal(output.Bytes(), entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.ErrorChain) != 2 || entry.ErrorChain[1].ElidedFrames == 0 ||
+		hasFrame(entry.ErrorChain[1].Stack, "TestErrorChainElidesFrames") {
+		t.Fatalf("expected frames shared with outer cause elided, got:%s", output.String())
+	}
+}
+
+func TestErrorStackDebugOnly(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output), log.WithFormat(&log.FormatConf{ErrorStackDebugOnly: true}))
+	logger.Error(findUser())
+	entry := &errorEntry{}
+	if err := json.Unmarshal(output.Bytes(), entry); err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.ErrorChain) == 0 || entry.ErrorChain[0].Stack != nil {
+		t.Fatalf("expected no stack at info level, got:%s", output.String())
+	}
+
+	output.Reset()
+	logger.SetLevel(log.DebugLevel)
+	logger.Error(findUser())
+	if err := json.Unmarshal(output.Bytes(), entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.ErrorChain[0].Stack == nil {
+		t.Fatalf("expected stack at debug level, got:%s", output.String())
+	}
+}
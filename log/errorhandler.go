@@ -0,0 +1,38 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrorHandler 处理日志库自身无法再通过日志输出的错误,如远端发送失败、异步写失败
+type ErrorHandler func(msg string, err error)
+
+var (
+	errorHandler  ErrorHandler = stderrErrorHandler
+	errorHandlerM sync.RWMutex
+)
+
+func stderrErrorHandler(msg string, err error) {
+	fmt.Fprintf(os.Stderr, "%s:%v\n", msg, err)
+}
+
+// SetErrorHandler 为nil时恢复为输出到stderr,测试中可用于静默或断言
+func SetErrorHandler(handler ErrorHandler) {
+	if handler == nil {
+		handler = stderrErrorHandler
+	}
+	errorHandlerM.Lock()
+	defer errorHandlerM.Unlock()
+	errorHandler = handler
+}
+
+// reportError component用于metrics标签,如async、remote
+func reportError(component, msg string, err error) {
+	internalErrors.WithLabelValues(component).Inc()
+	errorHandlerM.RLock()
+	handler := errorHandler
+	errorHandlerM.RUnlock()
+	handler(msg, err)
+}
@@ -44,9 +44,17 @@ var (
 
 // RotateConf RotateConf
 type RotateConf struct {
-	RotateType    RotateType `toml:"rotate_type" yaml:"rotate_type" json:"rotate_type"`
-	RotateArg     string     `toml:"rotate_arg" yaml:"rotate_arg" json:"rotate_arg"`
-	FileFormatter FileFormatter
+	RotateType RotateType `toml:"rotate_type" yaml:"rotate_type" json:"rotate_type"`
+	RotateArg  string     `toml:"rotate_arg" yaml:"rotate_arg" json:"rotate_arg"`
+	// MaxBackups 保留的旧文件数,0表示不限制
+	MaxBackups int `toml:"max_backups" yaml:"max_backups" json:"max_backups" nullable:"true"`
+	// MaxAge 旧文件的保留时长,为空表示不限制
+	MaxAge string `toml:"max_age" yaml:"max_age" json:"max_age" nullable:"true"`
+	// Compress 后台gzip压缩旧文件
+	Compress bool `toml:"compress" yaml:"compress" json:"compress" nullable:"true"`
+	// Symlink 维护file指向当前文件的软链接
+	Symlink       bool          `toml:"symlink" yaml:"symlink" json:"symlink" nullable:"true"`
+	FileFormatter FileFormatter `toml:"-" yaml:"-" json:"-"`
 }
 
 func (rc *RotateConf) fill() {
@@ -85,18 +93,30 @@ type periodRotatedOutput struct {
 	bytes  uint64
 	sync.Mutex
 	fileFormatter FileFormatter
+	keeper        *rotateKeeper
+	done          chan struct{}
+	closed        bool
 }
 
 func (p *periodRotatedOutput) run() {
 	ticker := time.NewTicker(p.d)
-	for range ticker.C {
-		p.swapOutpout()
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.swapOutpout()
+		}
 	}
 }
 
 func (p *periodRotatedOutput) swapOutpout() {
 	p.Lock()
 	defer p.Unlock()
+	if p.closed {
+		return
+	}
 	nextFile := p.fileFormatter(p.file)
 	f, err := os.OpenFile(nextFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
@@ -110,11 +130,15 @@ func (p *periodRotatedOutput) swapOutpout() {
 		Error(err)
 	}
 	p.output = f
+	p.keeper.rotated(nextFile)
 }
 
 func (p *periodRotatedOutput) Write(b []byte) (int, error) {
 	p.Lock()
 	defer p.Unlock()
+	if p.closed {
+		return 0, errorsx.Trace(os.ErrClosed)
+	}
 	n, err := p.output.Write(b)
 	if err != nil {
 		return n, errorsx.Trace(err)
@@ -125,6 +149,12 @@ func (p *periodRotatedOutput) Write(b []byte) (int, error) {
 func (p *periodRotatedOutput) Close() error {
 	p.Lock()
 	defer p.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	p.keeper.stop()
 	if err := p.output.Close(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -134,6 +164,9 @@ func (p *periodRotatedOutput) Close() error {
 func (p *periodRotatedOutput) Sync() error {
 	p.Lock()
 	defer p.Unlock()
+	if p.closed {
+		return errorsx.Trace(os.ErrClosed)
+	}
 	if err := p.output.Sync(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -147,11 +180,16 @@ type sizeRotatedOutput struct {
 	bytes  uint64
 	sync.Mutex
 	fileFormatter FileFormatter
+	keeper        *rotateKeeper
+	closed        bool
 }
 
 func (s *sizeRotatedOutput) Sync() error {
 	s.Lock()
 	defer s.Unlock()
+	if s.closed {
+		return errorsx.Trace(os.ErrClosed)
+	}
 	if err := s.output.Sync(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -161,6 +199,11 @@ func (s *sizeRotatedOutput) Sync() error {
 func (s *sizeRotatedOutput) Close() error {
 	s.Lock()
 	defer s.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.keeper.stop()
 	if err := s.output.Close(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -170,6 +213,9 @@ func (s *sizeRotatedOutput) Close() error {
 func (s *sizeRotatedOutput) Write(b []byte) (int, error) {
 	s.Lock()
 	defer s.Unlock()
+	if s.closed {
+		return 0, errorsx.Trace(os.ErrClosed)
+	}
 	if s.bytes >= s.size {
 		s.swapOutpout()
 	}
@@ -196,6 +242,7 @@ func (s *sizeRotatedOutput) swapOutpout() {
 	}
 	s.output = f
 	s.bytes = 0
+	s.keeper.rotated(nextFile)
 }
 
 // BuildRotatedOutput BuildRotatedOutput
@@ -232,7 +279,15 @@ func BuildPeriodRotatedOutput(file string, rotateConf *RotateConf) WriteSyncClos
 	if err != nil {
 		Fatalf("failed to OpenFile:%s,err:%v", nextFile, err)
 	}
-	p := &periodRotatedOutput{file: file, output: f, d: d, fileFormatter: rotateConf.FileFormatter}
+	p := &periodRotatedOutput{
+		file:          file,
+		output:        f,
+		d:             d,
+		fileFormatter: rotateConf.FileFormatter,
+		keeper:        newRotateKeeper(file, rotateConf),
+		done:          make(chan struct{}),
+	}
+	p.keeper.rotated(nextFile)
 	go p.run()
 	return p
 }
@@ -268,7 +323,14 @@ func BuildSizeRotatedOutput(file string, rotateConf *RotateConf) WriteSyncCloser
 	if err != nil {
 		Fatalf("failed to OpenFile:%s,err:%v", nextFile, err)
 	}
-	p := &sizeRotatedOutput{file: nextFile, output: f, size: parseSize(rotateConf.RotateArg), fileFormatter: rotateConf.FileFormatter}
+	p := &sizeRotatedOutput{
+		file:          file,
+		output:        f,
+		size:          parseSize(rotateConf.RotateArg),
+		fileFormatter: rotateConf.FileFormatter,
+		keeper:        newRotateKeeper(file, rotateConf),
+	}
+	p.keeper.rotated(nextFile)
 	return p
 }
 
@@ -0,0 +1,121 @@
+package log_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/log"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotateRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "app.log")
+	now := time.Now()
+	for i := 1; i <= 4; i++ {
+		backup := filepath.Join(dir, now.Add(-time.Duration(i)*time.Hour).Format("2006-01-02-15-04-05")+".app.log")
+		if err := ioutil.WriteFile(backup, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(backup, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := log.BuildRotatedOutput(file, &log.RotateConf{
+		RotateType: log.SizeRotateType,
+		RotateArg:  "1kb",
+		MaxBackups: 3,
+		MaxAge:     "150m",
+		Compress:   true,
+		Symlink:    true,
+	})
+	defer output.Close()
+	if _, err := output.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func() []string {
+		infos, _ := ioutil.ReadDir(dir)
+		names := make([]string, 0, len(infos))
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+	waitFor(t, func() bool {
+		gz := 0
+		names := list()
+		for _, name := range names {
+			if strings.HasSuffix(name, ".app.log.gz") {
+				gz++
+			}
+		}
+		// app.log, 当前文件, 两个压缩的旧文件, other.txt
+		return gz == 2 && len(names) == 5
+	})
+
+	target, err := os.Readlink(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello\n" {
+		t.Fatalf("expected symlink to current file, got:%q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatedOutputWriteAfterClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, rotateType := range []log.RotateType{log.SizeRotateType, log.PeriodRotateType} {
+		output := log.BuildRotatedOutput(filepath.Join(dir, string(rotateType)+".log"), &log.RotateConf{
+			RotateType: rotateType,
+			RotateArg:  "1b",
+		})
+		if _, err := output.Write([]byte("hello\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := output.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := output.Write([]byte("hello\n")); !errors.Is(err, os.ErrClosed) {
+			t.Fatalf("expected:%v,got:%v", os.ErrClosed, err)
+		}
+		if err := output.Close(); err != nil {
+			t.Fatalf("expected:%v,got:%v", nil, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package log
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/wwq-2020/go.common/stack"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TimeFormats 其他值按time.Format的layout处理
+const (
+	TimeFormatDateTime    = "datetime"
+	TimeFormatRFC3339Nano = "rfc3339nano"
+	TimeFormatEpoch       = "epoch"
+	TimeFormatEpochMillis = "epoch_millis"
+	TimeFormatEpochNanos  = "epoch_nanos"
+	dateTimeLayout        = "2006-01-02 15:04:05"
+)
+
+// vars
+var (
+	DefaultTimeKey    = "ts"
+	DefaultLevelKey   = "level"
+	DefaultMessageKey = "msg"
+	DefaultCallerKey  = "caller"
+)
+
+// FormatConf FormatConf
+type FormatConf struct {
+	TimeFormat string `toml:"time_format" yaml:"time_format" json:"time_format" nullable:"true"`
+	// UTC 为false时使用本地时区
+	UTC        bool   `toml:"utc" yaml:"utc" json:"utc" nullable:"true"`
+	FullCaller bool   `toml:"full_caller" yaml:"full_caller" json:"full_caller" nullable:"true"`
+	TimeKey    string `toml:"time_key" yaml:"time_key" json:"time_key" nullable:"true"`
+	LevelKey   string `toml:"level_key" yaml:"level_key" json:"level_key" nullable:"true"`
+	MessageKey string `toml:"message_key" yaml:"message_key" json:"message_key" nullable:"true"`
+	CallerKey  string `toml:"caller_key" yaml:"caller_key" json:"caller_key" nullable:"true"`
+	// ErrorStackDebugOnly 只在debug级别时输出错误链的调用栈
+	ErrorStackDebugOnly bool `toml:"error_stack_debug_only" yaml:"error_stack_debug_only" json:"error_stack_debug_only" nullable:"true"`
+	// Fields 每条日志都带上的字段,如service/host/pod,值支持${ENV}
+	Fields map[string]string `toml:"fields" yaml:"fields" json:"fields" nullable:"true"`
+}
+
+func (c *FormatConf) fill() {
+	if c.TimeFormat == "" {
+		c.TimeFormat = TimeFormatDateTime
+	}
+	if c.TimeKey == "" {
+		c.TimeKey = DefaultTimeKey
+	}
+	if c.LevelKey == "" {
+		c.LevelKey = DefaultLevelKey
+	}
+	if c.MessageKey == "" {
+		c.MessageKey = DefaultMessageKey
+	}
+	if c.CallerKey == "" {
+		c.CallerKey = DefaultCallerKey
+	}
+}
+
+func defaultFormatConf() *FormatConf {
+	conf := &FormatConf{}
+	conf.fill()
+	return conf
+}
+
+// WithFormat WithFormat
+func WithFormat(conf *FormatConf) Option {
+	return func(o *Options) {
+		formatConf := *conf
+		formatConf.fill()
+		o.format = &formatConf
+	}
+}
+
+// FormatGetter 可选实现,自定义Logger未实现时FormatOf返回默认的FormatConf
+type FormatGetter interface {
+	GetFormat() *FormatConf
+}
+
+// FormatOf logger生效的FormatConf,用于按配置的key解析日志
+func FormatOf(logger Logger) *FormatConf {
+	if getter, ok := logger.(FormatGetter); ok {
+		return getter.GetFormat()
+	}
+	return defaultFormatConf()
+}
+
+// GetFormat GetFormat
+func (l *logger) GetFormat() *FormatConf {
+	formatConf := *l.options.format
+	return &formatConf
+}
+
+func buildEncoderConfig(conf *FormatConf) zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        conf.TimeKey,
+		LevelKey:       conf.LevelKey,
+		NameKey:        "logger",
+		MessageKey:     conf.MessageKey,
+		StacktraceKey:  "stacktrace",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     buildTimeEncoder(conf.TimeFormat, conf.UTC),
+		EncodeDuration: zapcore.SecondsDurationEncoder,
+	}
+}
+
+func buildTimeEncoder(format string, utc bool) zapcore.TimeEncoder {
+	var encode zapcore.TimeEncoder
+	switch format {
+	case TimeFormatDateTime:
+		encode = zapcore.TimeEncoderOfLayout(dateTimeLayout)
+	case TimeFormatRFC3339Nano:
+		encode = zapcore.RFC3339NanoTimeEncoder
+	case TimeFormatEpoch:
+		encode = zapcore.EpochTimeEncoder
+	case TimeFormatEpochMillis:
+		encode = zapcore.EpochMillisTimeEncoder
+	case TimeFormatEpochNanos:
+		encode = zapcore.EpochNanosTimeEncoder
+	default:
+		encode = zapcore.TimeEncoderOfLayout(format)
+	}
+	if !utc {
+		return encode
+	}
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		encode(t.UTC(), enc)
+	}
+}
+
+func (c *FormatConf) staticFields() []zap.Field {
+	keys := make([]string, 0, len(c.Fields))
+	for key := range c.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]zap.Field, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, zap.String(key, os.ExpandEnv(c.Fields[key])))
+	}
+	return fields
+}
+
+func (l *logger) callerField(depth int) zap.Field {
+	if l.options.format.FullCaller {
+		return zap.String(l.options.format.CallerKey, stack.FullCaller(depth+1))
+	}
+	return zap.String(l.options.format.CallerKey, stack.Caller(depth+1))
+}
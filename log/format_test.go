@@ -0,0 +1,50 @@
+package log_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/log"
+)
+
+func TestFormat(t *testing.T) {
+	os.Setenv("LOG_TEST_POD", "pod-1")
+	defer os.Unsetenv("LOG_TEST_POD")
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output), log.WithFormat(&log.FormatConf{
+		TimeFormat: log.TimeFormatRFC3339Nano,
+		UTC:        true,
+		FullCaller: true,
+		TimeKey:    "@timestamp",
+		MessageKey: "message",
+		CallerKey:  "source",
+		Fields: map[string]string{
+			"service": "demo",
+			"pod":     "${LOG_TEST_POD}",
+		},
+	}))
+	logger.Info("hello")
+
+	entry := make(map[string]interface{})
+	if err := json.Unmarshal(output.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	ts, _ := entry["@timestamp"].(string)
+	parsed, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := parsed.Zone(); offset != 0 || !strings.HasSuffix(ts, "Z") {
+		t.Fatalf("expected utc timestamp, got:%s", ts)
+	}
+	if entry["message"] != "hello" || entry["service"] != "demo" || entry["pod"] != "pod-1" {
+		t.Fatalf("unexpected entry:%v", entry)
+	}
+	source, _ := entry["source"].(string)
+	if !strings.Contains(source, "log_test.TestFormat@") || !strings.Contains(source, "/log/format_test.go:") {
+		t.Fatalf("expected full caller, got:%s", source)
+	}
+}
@@ -2,11 +2,65 @@ package log
 
 import (
 	"strings"
+	"sync/atomic"
+
+	"github.com/wwq-2020/go.common/errorsx"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// atomicLevel 写入时读取,SetLevel只做原子写,With等派生的logger共享同一个级别
+type atomicLevel struct {
+	v int64
+}
+
+func newAtomicLevel(level Level) *atomicLevel {
+	return &atomicLevel{v: int64(level)}
+}
+
+func (a *atomicLevel) Load() Level {
+	return Level(atomic.LoadInt64(&a.v))
+}
+
+func (a *atomicLevel) Store(level Level) {
+	atomic.StoreInt64(&a.v, int64(level))
+}
+
+// levelFilterCore 按enab过滤,修改级别时不需要重建core
+type levelFilterCore struct {
+	zapcore.Core
+	enab zapcore.LevelEnabler
+}
+
+func (c *levelFilterCore) Enabled(level zapcore.Level) bool {
+	return c.enab.Enabled(level) && c.Core.Enabled(level)
+}
+
+func (c *levelFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelFilterCore{
+		Core: c.Core.With(fields),
+		enab: c.enab,
+	}
+}
+
+func (c *levelFilterCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.enab.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// withLevelEnabler 替换core的级别过滤,保留With添加的字段
+func withLevelEnabler(enab zapcore.LevelEnabler) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if filter, ok := core.(*levelFilterCore); ok {
+			return &levelFilterCore{Core: filter.Core, enab: enab}
+		}
+		return &levelFilterCore{Core: core, enab: enab}
+	})
+}
+
 func (l Level) toZapLevel() zap.AtomicLevel {
 	switch l {
 	case PanicLevel:
@@ -26,6 +80,34 @@ func (l Level) toZapLevel() zap.AtomicLevel {
 	}
 }
 
+func (l Level) toZapcoreLevel() zapcore.Level {
+	switch l {
+	case PanicLevel:
+		return zapcore.PanicLevel
+	case FatalLevel:
+		return zapcore.FatalLevel
+	case ErrorLevel:
+		return zapcore.ErrorLevel
+	case WarnLevel:
+		return zapcore.WarnLevel
+	case DebugLevel:
+		return zapcore.DebugLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// ParseLevel ParseLevel
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+	case "panic", "fatal", "error", "warn", "info", "debug":
+		return parseStringLevel(level), nil
+	default:
+		return InfoLevel, errorsx.New("unknown level").
+			WithField("level", level)
+	}
+}
+
 func parseStringLevel(level string) Level {
 	switch strings.ToLower(level) {
 	case "panic":
@@ -44,3 +126,23 @@ func parseStringLevel(level string) Level {
 		return InfoLevel
 	}
 }
+
+// String String
+func (l Level) String() string {
+	switch l {
+	case PanicLevel:
+		return "panic"
+	case FatalLevel:
+		return "fatal"
+	case ErrorLevel:
+		return "error"
+	case WarnLevel:
+		return "warn"
+	case InfoLevel:
+		return "info"
+	case DebugLevel:
+		return "debug"
+	default:
+		return "info"
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
 	"github.com/wwq-2020/go.common/errorsx"
 	"github.com/wwq-2020/go.common/stack"
@@ -117,6 +116,8 @@ type logger struct {
 	depth     int
 	options   *Options
 	withStack bool
+	// fieldKeys WithField等设置过的key,ctx中同名字段不再输出
+	fieldKeys map[string]struct{}
 }
 
 // New 初始化Logger
@@ -131,13 +132,33 @@ func WithOutput(output io.WriteCloser) Option {
 	}
 }
 
+// WithAsyncOutput 通过异步缓冲写入output
+func WithAsyncOutput(output io.WriteCloser, conf *AsyncConf) Option {
+	return func(o *Options) {
+		o.output = NewAsyncOutput(output, conf)
+	}
+}
+
+// WithCore 额外接收日志的core,与output或sink并行,拿到的是未编码的entry和字段
+func WithCore(core zapcore.Core) Option {
+	return func(o *Options) {
+		o.cores = append(o.cores[:len(o.cores):len(o.cores)], core)
+	}
+}
+
 // Option Option
 type Option func(*Options)
 
 // Options Options
 type Options struct {
-	output io.WriteCloser
-	level  Level
+	output      io.WriteCloser
+	level       *atomicLevel
+	sinks       []*Sink
+	cores       []zapcore.Core
+	sampling    []*SamplingConf
+	format      *FormatConf
+	name        string
+	parentLevel func() Level
 }
 
 // SetOutput SetOutput
@@ -145,17 +166,25 @@ func SetOutput(output io.WriteCloser) {
 	defaultOptions.output = output
 	std = NewEx(1)
 	stdWith = NewEx(0)
+	namedLoggers.reset()
+}
+
+// GetLogger 当前的全局logger
+func GetLogger() Logger {
+	return stdWith
 }
 
 // SetLogger SetLogger
 func SetLogger(logger Logger) {
 	std = logger.AddDep(1)
 	stdWith = logger
+	namedLoggers.reset()
 }
 
 // NewEx 初始化Logger
 func NewEx(depth int, opts ...Option) Logger {
 	options := defaultOptions
+	options.level = newAtomicLevel(defaultOptions.level.Load())
 	for _, opt := range opts {
 		opt(&options)
 	}
@@ -168,28 +197,27 @@ func NewEx(depth int, opts ...Option) Logger {
 	}
 }
 
-var (
-	zapEncoderConfig = zapcore.EncoderConfig{
-		TimeKey:       "ts",
-		LevelKey:      "level",
-		NameKey:       "logger",
-		CallerKey:     "caller",
-		MessageKey:    "msg",
-		StacktraceKey: "stacktrace",
-		LineEnding:    zapcore.DefaultLineEnding,
-		EncodeLevel:   zapcore.LowercaseLevelEncoder,
-		EncodeTime: func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-			time := t.Format("2006-01-02 15:04:05")
-			enc.AppendString(time)
-		},
-		EncodeDuration: zapcore.SecondsDurationEncoder,
-		EncodeCaller:   zapcore.ShortCallerEncoder,
-	}
-)
-
 func buildZapLogger(options *Options) *zap.Logger {
-	encoder := zapcore.NewJSONEncoder(zapEncoderConfig)
-	core := zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(options.output)), options.level.toZapLevel())
+	var core zapcore.Core
+	if len(options.sinks) > 0 {
+		core = buildTeeCore(options)
+	} else {
+		encoder := zapcore.NewJSONEncoder(buildEncoderConfig(options.format))
+		core = buildCore(encoder, options.output, zapcore.DebugLevel)
+	}
+	if len(options.cores) > 0 {
+		core = zapcore.NewTee(append([]zapcore.Core{core}, options.cores...)...)
+	}
+	if fields := options.format.staticFields(); len(fields) > 0 {
+		core = core.With(fields)
+	}
+	if len(options.sampling) > 0 {
+		core = newSamplingCore(core, options.sampling)
+	}
+	core = &levelFilterCore{Core: core, enab: options.levelEnabler()}
+	if options.name != "" {
+		return zap.New(core).Named(options.name)
+	}
 	return zap.New(core)
 }
 
@@ -198,7 +226,8 @@ var (
 	stdWith        = NewEx(0)
 	defaultOptions = Options{
 		output: os.Stdout,
-		level:  InfoLevel,
+		level:  newAtomicLevel(InfoLevel),
+		format: defaultFormatConf(),
 	}
 )
 
@@ -360,11 +389,31 @@ func PanicContext(ctx context.Context, msg string) {
 // SetLevel SetLevel
 func SetLevel(level Level) {
 	std.SetLevel(level)
+	stdWith.SetLevel(level)
 }
 
 // SetStringLevel SetStringLevel
 func SetStringLevel(level string) {
 	std.SetStringLevel(level)
+	stdWith.SetStringLevel(level)
+}
+
+// LevelGetter 可选实现,自定义Logger未实现时GetLevel返回InfoLevel
+type LevelGetter interface {
+	GetLevel() Level
+}
+
+// GetLevel GetLevel
+func GetLevel() Level {
+	return LevelOf(std)
+}
+
+// LevelOf logger当前的级别
+func LevelOf(logger Logger) Level {
+	if getter, ok := logger.(LevelGetter); ok {
+		return getter.GetLevel()
+	}
+	return InfoLevel
 }
 
 // WithFields WithFields
@@ -408,7 +457,7 @@ func (l *logger) Infof(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Info(fmt.Sprintf(msg, args...))
 }
 
@@ -418,7 +467,7 @@ func (l *logger) Info(msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Info(msg)
 }
 
@@ -428,14 +477,14 @@ func (l *logger) Errorf(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Error(fmt.Sprintf(msg, args...))
 }
 
 // Error Error
 func (l *logger) Error(err error) {
-	errFields := zapFieldsFromError(err)
-	l.l.With(zap.String("caller", stack.Caller(l.depth+1))).
+	errFields := l.errorFields(err)
+	l.l.With(l.callerField(l.depth + 1)).
 		With(errFields...).
 		Error(err.Error())
 }
@@ -446,7 +495,7 @@ func (l *logger) Warnf(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Warn(fmt.Sprintf(msg, args...))
 }
 
@@ -456,7 +505,7 @@ func (l *logger) Warn(msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Warn(msg)
 }
 
@@ -466,7 +515,7 @@ func (l *logger) Debugf(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Debug(fmt.Sprintf(msg, args...))
 }
 
@@ -476,7 +525,7 @@ func (l *logger) Debug(msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Debug(msg)
 }
 
@@ -486,7 +535,7 @@ func (l *logger) Fatalf(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Fatal(fmt.Sprintf(msg, args...))
 }
 
@@ -496,7 +545,7 @@ func (l *logger) Fatal(msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Fatal(msg)
 }
 
@@ -506,7 +555,7 @@ func (l *logger) Panicf(msg string, args ...interface{}) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Panic(fmt.Sprintf(msg, args...))
 }
 
@@ -516,7 +565,7 @@ func (l *logger) Panic(msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	logger.With(zap.String("caller", stack.Caller(l.depth+1))).
+	logger.With(l.callerField(l.depth + 1)).
 		Panic(msg)
 }
 
@@ -526,9 +575,9 @@ func (l *logger) InfofContext(ctx context.Context, msg string, args ...interface
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Info(fmt.Sprintf(msg, args...))
 }
 
@@ -538,9 +587,9 @@ func (l *logger) InfoContext(ctx context.Context, msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Info(msg)
 }
 
@@ -550,18 +599,18 @@ func (l *logger) ErrorfContext(ctx context.Context, msg string, args ...interfac
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Error(fmt.Sprintf(msg, args...))
 }
 
 // ErrorContext ErrorContext
 func (l *logger) ErrorContext(ctx context.Context, err error) {
-	errFields := zapFieldsFromError(err)
-	ctxFields := zapFieldsFromContext(ctx)
+	errFields := l.errorFields(err)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	l.l.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		With(errFields...).
 		Error(err.Error())
 }
@@ -572,9 +621,9 @@ func (l *logger) WarnfContext(ctx context.Context, msg string, args ...interface
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Warn(fmt.Sprintf(msg, args...))
 }
 
@@ -584,9 +633,9 @@ func (l *logger) WarnContext(ctx context.Context, msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Warn(msg)
 }
 
@@ -596,9 +645,9 @@ func (l *logger) DebugfContext(ctx context.Context, msg string, args ...interfac
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Debug(fmt.Sprintf(msg, args...))
 }
 
@@ -608,9 +657,9 @@ func (l *logger) DebugContext(ctx context.Context, msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Debug(msg)
 }
 
@@ -620,9 +669,9 @@ func (l *logger) FatalfContext(ctx context.Context, msg string, args ...interfac
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Fatal(fmt.Sprintf(msg, args...))
 }
 
@@ -632,9 +681,9 @@ func (l *logger) FatalContext(ctx context.Context, msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Fatal(msg)
 }
 
@@ -644,9 +693,9 @@ func (l *logger) PanicfContext(ctx context.Context, msg string, args ...interfac
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Panic(fmt.Sprintf(msg, args...))
 }
 
@@ -656,26 +705,33 @@ func (l *logger) PanicContext(ctx context.Context, msg string) {
 	if l.withStack {
 		logger = logger.With(zap.String("stack", stack.Callers(stack.StdFilter)))
 	}
-	ctxFields := zapFieldsFromContext(ctx)
+	ctxFields := l.zapFieldsFromContext(ctx)
 	logger.With(ctxFields...).
-		With(zap.String("caller", stack.Caller(l.depth+1))).
+		With(l.callerField(l.depth + 1)).
 		Panic(msg)
 }
 
-// SetLevel SetLevel
+// SetLevel 带名字的logger设置的是名字对应的级别,With等派生的logger共享同一个级别
 func (l *logger) SetLevel(level Level) {
-	l.options.level = level
-	zapLogger := buildZapLogger(l.options)
-	l.l = zapLogger
-	return
+	if l.options.name != "" {
+		SetLevelByName(l.options.name, level)
+		return
+	}
+	l.options.level.Store(level)
 }
 
 // SetStringLevel SetStringLevel
 func (l *logger) SetStringLevel(level string) {
-	l.options.level = parseStringLevel(level)
-	zapLogger := buildZapLogger(l.options)
-	l.l = zapLogger
-	return
+	if l.options.name != "" {
+		SetLevelByName(l.options.name, parseStringLevel(level))
+		return
+	}
+	l.options.level.Store(parseStringLevel(level))
+}
+
+// GetLevel GetLevel
+func (l *logger) GetLevel() Level {
+	return l.effectiveLevel()
 }
 
 // WithFields WithFields
@@ -686,6 +742,7 @@ func (l *logger) WithFields(fields stack.Fields) Logger {
 		depth:     l.depth,
 		options:   &options,
 		withStack: l.withStack,
+		fieldKeys: l.withFieldKeys(fields.KVs()),
 	}
 }
 
@@ -697,6 +754,7 @@ func (l *logger) WithStack() Logger {
 		l:         l.l,
 		depth:     l.depth,
 		options:   &options,
+		fieldKeys: l.fieldKeys,
 	}
 
 }
@@ -709,18 +767,19 @@ func (l *logger) WithZapFields(fields ...zap.Field) Logger {
 		depth:     l.depth,
 		options:   &options,
 		withStack: l.withStack,
+		fieldKeys: l.withZapFieldKeys(fields),
 	}
 }
 
 // WithError WithError
 func (l *logger) WithError(err error) Logger {
-	stack := errorsx.FullFields(err)
 	options := *l.options
 	return &logger{
-		l:         l.l.With(fields2ZapFields(stack)...),
+		l:         l.l.With(l.errorFields(err)...),
 		depth:     l.depth,
 		withStack: l.withStack,
 		options:   &options,
+		fieldKeys: l.fieldKeys,
 	}
 }
 
@@ -732,6 +791,7 @@ func (l *logger) WithField(key string, val interface{}) Logger {
 		withStack: l.withStack,
 		depth:     l.depth,
 		options:   &options,
+		fieldKeys: l.withFieldKeys(map[string]interface{}{key: val}),
 	}
 }
 
@@ -743,10 +803,21 @@ func (l *logger) Sync() error {
 }
 
 func (l *logger) Close() error {
-	if err := l.options.output.Close(); err != nil {
-		return errorsx.Trace(err)
+	// 关闭前输出采样汇总等缓冲的内容
+	l.l.Sync()
+	if len(l.options.sinks) == 0 {
+		if err := l.options.output.Close(); err != nil {
+			return errorsx.Trace(err)
+		}
+		return nil
 	}
-	return nil
+	var err error
+	for _, sink := range l.options.sinks {
+		if closeErr := closeSinkOutput(sink.Output); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 func (l *logger) Dup() Logger {
@@ -757,6 +828,7 @@ func (l *logger) Dup() Logger {
 		l:         &zapLogger,
 		depth:     l.depth,
 		options:   &options,
+		fieldKeys: l.fieldKeys,
 	}
 }
 
@@ -768,5 +840,6 @@ func (l *logger) AddDep(depth int) Logger {
 		withStack: l.withStack,
 		depth:     l.depth + depth,
 		options:   &options,
+		fieldKeys: l.fieldKeys,
 	}
 }
@@ -0,0 +1,75 @@
+package logtest_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/log/logtest"
+)
+
+func handle(ctx context.Context) {
+	log.WithField("user", "u1").
+		WithField("attempt", 2).
+		ErrorContext(ctx, errors.New("boom"))
+	log.InfoContext(ctx, "done")
+}
+
+func TestSetupStd(t *testing.T) {
+	old := log.GetLogger()
+	t.Run("observe", func(t *testing.T) {
+		observer := logtest.SetupStd(t)
+		ctx := log.ContextWithTraceID(context.Background(), "trace-1")
+		handle(ctx)
+
+		errs := observer.All().Level(log.ErrorLevel)
+		if errs.Len() != 1 {
+			t.Fatalf("expected 1 error entry, got:%d", errs.Len())
+		}
+		entry := errs[0]
+		if entry.Message != "boom" || entry.TraceID != "trace-1" || entry.Caller == "" {
+			t.Fatalf("unexpected entry:%+v", entry)
+		}
+		if observer.All().Field("user", "u1").Field("attempt", 2).Len() != 1 {
+			t.Fatalf("expected fields recorded, got:%+v", entry.Fields)
+		}
+		if observer.All().TraceID("trace-1").Message("done").Len() != 1 {
+			t.Fatalf("expected info entry with trace id")
+		}
+		observer.Reset()
+		if observer.Len() != 0 {
+			t.Fatal("expected no entries after reset")
+		}
+	})
+	if log.GetLogger() != old {
+		t.Fatal("expected std logger restored after cleanup")
+	}
+}
+
+func TestObserverCustomFormat(t *testing.T) {
+	logger, observer := logtest.NewObserver(
+		log.WithFormat(&log.FormatConf{CallerKey: "source", MessageKey: "message"}),
+		log.WithSink(nopCloser{ioutil.Discard}, log.DebugLevel, log.LogfmtEncoding))
+	log.NamedFrom(logger, "worker").
+		WithField("user", "u1").
+		Warn("slow")
+	entries := observer.All().Level(log.WarnLevel).Message("slow")
+	if entries.Len() != 1 {
+		t.Fatalf("expected:%d,got:%d", 1, entries.Len())
+	}
+	entry := entries[0]
+	if entry.Caller == "" || entry.Logger != "worker" || entry.Fields["user"] != "u1" {
+		t.Fatalf("expected:%s,got:%+v", "caller,logger and user recorded", entry)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,205 @@
+package logtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+	"go.uber.org/zap/zapcore"
+)
+
+// Entry 一条记录下来的日志,Fields不包括level,msg等固定字段
+type Entry struct {
+	Level   log.Level
+	Message string
+	TraceID string
+	Logger  string
+	Caller  string
+	Fields  map[string]interface{}
+}
+
+// Entries Entries
+type Entries []*Entry
+
+func (es Entries) filter(match func(*Entry) bool) Entries {
+	var result Entries
+	for _, e := range es {
+		if match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Level 指定级别的日志
+func (es Entries) Level(level log.Level) Entries {
+	return es.filter(func(e *Entry) bool {
+		return e.Level == level
+	})
+}
+
+// Message 消息完全相同的日志
+func (es Entries) Message(msg string) Entries {
+	return es.filter(func(e *Entry) bool {
+		return e.Message == msg
+	})
+}
+
+// MessageContains 消息包含sub的日志
+func (es Entries) MessageContains(sub string) Entries {
+	return es.filter(func(e *Entry) bool {
+		return strings.Contains(e.Message, sub)
+	})
+}
+
+// Field 带有key且值相同的日志,值按fmt.Sprint比较
+func (es Entries) Field(key string, val interface{}) Entries {
+	expected := fmt.Sprint(val)
+	return es.filter(func(e *Entry) bool {
+		got, exist := e.Fields[key]
+		return exist && fmt.Sprint(got) == expected
+	})
+}
+
+// HasField 带有key的日志
+func (es Entries) HasField(key string) Entries {
+	return es.filter(func(e *Entry) bool {
+		_, exist := e.Fields[key]
+		return exist
+	})
+}
+
+// TraceID 指定traceID的日志
+func (es Entries) TraceID(traceID string) Entries {
+	return es.filter(func(e *Entry) bool {
+		return e.TraceID == traceID
+	})
+}
+
+// Len Len
+func (es Entries) Len() int {
+	return len(es)
+}
+
+// Observer 在zapcore层记录日志,不经过encoder,编码与key的配置不影响记录
+type Observer struct {
+	callerKey string
+	entries   Entries
+	sync.Mutex
+}
+
+// NewObserver 返回debug级别的logger及其Observer,日志不再写到output
+func NewObserver(opts ...log.Option) (log.Logger, *Observer) {
+	observer := &Observer{}
+	opts = append([]log.Option{log.WithOutput(discard{})}, opts...)
+	opts = append(opts, log.WithCore(&observerCore{observer: observer}))
+	logger := log.New(opts...)
+	logger.SetLevel(log.DebugLevel)
+	observer.callerKey = log.FormatOf(logger).CallerKey
+	return logger, observer
+}
+
+// SetupStd 用Observer替换全局logger,测试结束时恢复
+func SetupStd(tb testing.TB, opts ...log.Option) *Observer {
+	tb.Helper()
+	old := log.GetLogger()
+	logger, observer := NewObserver(opts...)
+	log.SetLogger(logger)
+	tb.Cleanup(func() {
+		log.SetLogger(old)
+	})
+	return observer
+}
+
+func (o *Observer) add(ent zapcore.Entry, fields []zapcore.Field) {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(enc)
+	}
+	entry := &Entry{
+		Message: ent.Message,
+		Logger:  ent.LoggerName,
+		Fields:  enc.Fields,
+	}
+	entry.Level, _ = log.ParseLevel(ent.Level.String())
+	entry.TraceID = popString(enc.Fields, "traceID")
+	if logger := popString(enc.Fields, "logger"); entry.Logger == "" {
+		entry.Logger = logger
+	}
+	o.Lock()
+	defer o.Unlock()
+	entry.Caller = popString(enc.Fields, o.callerKey)
+	o.entries = append(o.entries, entry)
+}
+
+func popString(fields map[string]interface{}, key string) string {
+	val, exist := fields[key]
+	if !exist {
+		return ""
+	}
+	delete(fields, key)
+	return fmt.Sprint(val)
+}
+
+// observerCore 级别过滤由logger外层完成,这里全部记录
+type observerCore struct {
+	observer *Observer
+	fields   []zapcore.Field
+}
+
+func (c *observerCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+func (c *observerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &observerCore{
+		observer: c.observer,
+		fields:   append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *observerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c *observerCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	c.observer.add(ent, append(c.fields[:len(c.fields):len(c.fields)], fields...))
+	return nil
+}
+
+func (c *observerCore) Sync() error {
+	return nil
+}
+
+type discard struct{}
+
+func (discard) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (discard) Close() error {
+	return nil
+}
+
+// All 全部日志
+func (o *Observer) All() Entries {
+	o.Lock()
+	defer o.Unlock()
+	return append(Entries(nil), o.entries...)
+}
+
+// Len Len
+func (o *Observer) Len() int {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.entries)
+}
+
+// Reset 清空已记录的日志
+func (o *Observer) Reset() {
+	o.Lock()
+	defer o.Unlock()
+	o.entries = nil
+}
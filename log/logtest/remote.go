@@ -0,0 +1,230 @@
+package logtest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+)
+
+// errs
+var (
+	ErrWaitTimeout = errorsx.Std("wait timeout")
+)
+
+// Server 远端日志接收方的本地替身,tcp同时支持json行与syslog octet counting分帧,
+// http支持ndjson/elasticsearch bulk(记录原始行,包括action行)与loki push
+type Server struct {
+	// Addr host:port
+	Addr string
+	// URL http时的请求地址
+	URL      string
+	network  string
+	lines    []string
+	requests int
+	failing  bool
+	closers  []io.Closer
+	httpSrv  *httptest.Server
+	changed  chan struct{}
+	sync.Mutex
+}
+
+// NewServer network为tcp,udp或http
+func NewServer(network string) (*Server, error) {
+	s := &Server{network: network, changed: make(chan struct{})}
+	switch network {
+	case "tcp":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		s.Addr = listener.Addr().String()
+		s.closers = append(s.closers, listener)
+		go s.accept(listener)
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		s.Addr = conn.LocalAddr().String()
+		s.closers = append(s.closers, conn)
+		go s.readPackets(conn)
+	case "http":
+		s.httpSrv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+		s.URL = s.httpSrv.URL
+		s.Addr = s.httpSrv.Listener.Addr().String()
+	default:
+		return nil, errorsx.New("unknown network").
+			WithField("network", network)
+	}
+	return s, nil
+}
+
+func (s *Server) add(lines ...string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, line := range lines {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			s.lines = append(s.lines, line)
+		}
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Lines 已收到的全部日志行
+func (s *Server) Lines() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// Requests http收到的请求数,包括失败的请求
+func (s *Server) Requests() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests
+}
+
+// WaitLines 等待至少收到n行
+func (s *Server) WaitLines(n int, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.Lock()
+		lines := append([]string(nil), s.lines...)
+		changed := s.changed
+		s.Unlock()
+		if len(lines) >= n {
+			return lines, nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return lines, errorsx.Trace(ErrWaitTimeout).
+				WithField("expected", n).
+				WithField("got", len(lines))
+		}
+	}
+}
+
+// SetFailing 为true时http返回503且不记录
+func (s *Server) SetFailing(failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failing = failing
+}
+
+// Close Close
+func (s *Server) Close() error {
+	if s.httpSrv != nil {
+		s.httpSrv.Close()
+	}
+	for _, closer := range s.closers {
+		closer.Close()
+	}
+	return nil
+}
+
+func (s *Server) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.Lock()
+		s.closers = append(s.closers, conn)
+		s.Unlock()
+		go s.readStream(conn)
+	}
+}
+
+func (s *Server) readStream(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if first[0] < '0' || first[0] > '9' {
+			line, err := reader.ReadString('\n')
+			s.add(line)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		lenStr, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(lenStr))
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			return
+		}
+		s.add(string(msg))
+	}
+}
+
+func (s *Server) readPackets(conn net.PacketConn) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.add(strings.Split(string(buf[:n]), "\n")...)
+	}
+}
+
+type lokiPush struct {
+	Streams []struct {
+		Values [][2]string `json:"values"`
+	} `json:"streams"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	s.requests++
+	failing := s.failing
+	s.Unlock()
+	if failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		push := &lokiPush{}
+		if err := json.Unmarshal(data, push); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, stream := range push.Streams {
+			for _, value := range stream.Values {
+				s.add(value[1])
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s.add(strings.Split(string(data), "\n")...)
+	w.WriteHeader(http.StatusOK)
+}
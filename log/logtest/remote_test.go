@@ -0,0 +1,26 @@
+package logtest_test
+
+import (
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/log/logtest"
+)
+
+func TestRemoteServer(t *testing.T) {
+	srv, err := logtest.NewServer("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	output, err := log.NewRemoteOutput(&log.RemoteConf{Type: log.HTTPRemoteType, Addr: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(log.WithOutput(output))
+	logger.Info("shipped")
+	logger.Close()
+	if lines := srv.Lines(); len(lines) != 1 || srv.Requests() != 1 {
+		t.Fatalf("unexpected lines:%v", lines)
+	}
+}
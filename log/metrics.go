@@ -0,0 +1,43 @@
+package log
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	asyncDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_async_dropped_total",
+		Help: "The total number of log entries dropped by a full async output per level.",
+	}, []string{"level"})
+	sampledDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_sampled_dropped_total",
+		Help: "The total number of log entries dropped by sampling or rate limiting per level.",
+	}, []string{"level"})
+	remoteSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_remote_sent_total",
+		Help: "The total number of log entries sent to a remote endpoint per type.",
+	}, []string{"type"})
+	remoteSpilled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_remote_spilled_total",
+		Help: "The total number of log entries spilled to disk after failing to send per type.",
+	}, []string{"type"})
+	remoteDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_remote_dropped_total",
+		Help: "The total number of log entries dropped by a remote output per type.",
+	}, []string{"type"})
+	internalErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_internal_errors_total",
+		Help: "The total number of errors inside log outputs that could not be logged per component.",
+	}, []string{"component"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		asyncDropped,
+		sampledDropped,
+		remoteSent,
+		remoteSpilled,
+		remoteDropped,
+		internalErrors,
+	)
+}
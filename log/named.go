@@ -0,0 +1,240 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// levelRegistry 按名字设置的日志级别,名字以.分隔层级,sqlx对sqlx.tx同样生效
+type levelRegistry struct {
+	levels map[string]Level
+	sync.RWMutex
+}
+
+var (
+	namedLevels  = &levelRegistry{levels: make(map[string]Level)}
+	namedLoggers = &namedCache{loggers: make(map[string]Logger)}
+)
+
+// namedCache 缓存Named创建的logger,SetOutput/SetLogger替换全局logger后失效
+type namedCache struct {
+	loggers map[string]Logger
+	sync.RWMutex
+}
+
+func (c *namedCache) get(name string) Logger {
+	c.RLock()
+	logger, exist := c.loggers[name]
+	c.RUnlock()
+	if exist {
+		return logger
+	}
+	c.Lock()
+	defer c.Unlock()
+	if logger, exist := c.loggers[name]; exist {
+		return logger
+	}
+	logger = NamedFrom(stdWith, name)
+	c.loggers[name] = logger
+	return logger
+}
+
+func (c *namedCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.loggers = make(map[string]Logger)
+}
+
+// lookup 最长前缀匹配,未设置时返回fallback
+func (r *levelRegistry) lookup(name string, fallback Level) Level {
+	r.RLock()
+	defer r.RUnlock()
+	for {
+		if level, exist := r.levels[name]; exist {
+			return level
+		}
+		idx := strings.LastIndexByte(name, '.')
+		if idx < 0 {
+			return fallback
+		}
+		name = name[:idx]
+	}
+}
+
+// Namer 可选实现,自定义Logger未实现时Named退化为带logger字段
+type Namer interface {
+	Named(string) Logger
+}
+
+// Named 带名字的子logger,级别可以通过SetLevelByName单独设置,未设置时跟随全局级别
+func Named(name string) Logger {
+	return namedLoggers.get(name)
+}
+
+// NamedFrom logger的带名字子logger
+func NamedFrom(logger Logger, name string) Logger {
+	if namer, ok := logger.(Namer); ok {
+		return namer.Named(name)
+	}
+	return logger.WithField("logger", name)
+}
+
+// SetLevelByName 设置name及其子logger的级别
+func SetLevelByName(name string, level Level) {
+	namedLevels.Lock()
+	defer namedLevels.Unlock()
+	namedLevels.levels[name] = level
+}
+
+// UnsetLevelByName 取消name的级别设置,恢复继承上级
+func UnsetLevelByName(name string) {
+	namedLevels.Lock()
+	defer namedLevels.Unlock()
+	delete(namedLevels.levels, name)
+}
+
+// LevelByName name当前生效的级别
+func LevelByName(name string) Level {
+	return namedLevels.lookup(name, GetLevel())
+}
+
+// NamedLevels 按名字设置的全部级别
+func NamedLevels() map[string]Level {
+	namedLevels.RLock()
+	defer namedLevels.RUnlock()
+	levels := make(map[string]Level, len(namedLevels.levels))
+	for name, level := range namedLevels.levels {
+		levels[name] = level
+	}
+	return levels
+}
+
+// Named 保留With添加的字段,级别过滤换为按名字查找
+func (l *logger) Named(name string) Logger {
+	options := *l.options
+	options.name = name
+	if l.options.name != "" {
+		options.name = l.options.name + "." + name
+	}
+	options.parentLevel = l.effectiveLevel
+	return &logger{
+		options:   &options,
+		depth:     l.depth,
+		withStack: l.withStack,
+		fieldKeys: l.fieldKeys,
+		l:         l.l.WithOptions(withLevelEnabler(options.levelEnabler())).Named(name),
+	}
+}
+
+func (l *logger) effectiveLevel() Level {
+	return l.options.effectiveLevel()
+}
+
+func (o *Options) effectiveLevel() Level {
+	if o.name == "" {
+		return o.level.Load()
+	}
+	fallback := o.level.Load()
+	if o.parentLevel != nil {
+		fallback = o.parentLevel()
+	}
+	return namedLevels.lookup(o.name, fallback)
+}
+
+// levelEnabler 每次写入时读取级别,带名字的logger按名字查找
+func (o *Options) levelEnabler() zapcore.LevelEnabler {
+	return zap.LevelEnablerFunc(func(level zapcore.Level) bool {
+		return level >= o.effectiveLevel().toZapcoreLevel()
+	})
+}
+
+type namedLevel struct {
+	Name  string `json:"name,omitempty"`
+	Level string `json:"level"`
+}
+
+type namedLevelsResp struct {
+	Global string            `json:"global"`
+	Levels map[string]string `json:"levels"`
+}
+
+// LevelHandler GET查看级别,PUT按name设置级别(name为空时设置全局级别),DELETE取消name的级别设置
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			obj := &namedLevel{
+				Name:  req.URL.Query().Get("name"),
+				Level: req.URL.Query().Get("level"),
+			}
+			if obj.Level == "" {
+				if err := json.NewDecoder(req.Body).Decode(obj); err != nil {
+					Error(errorsx.Trace(err))
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+			level, err := ParseLevel(obj.Level)
+			if err != nil {
+				Error(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if obj.Name == "" {
+				SetLevel(level)
+			} else {
+				SetLevelByName(obj.Name, level)
+			}
+			WithField("name", obj.Name).
+				WithField("level", level.String()).
+				Warn("log level changed")
+		case http.MethodDelete:
+			name := req.URL.Query().Get("name")
+			if name == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			UnsetLevelByName(name)
+			WithField("name", name).
+				Warn("log level unset")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeLevels(w)
+	})
+}
+
+func writeLevels(w http.ResponseWriter) {
+	levels := NamedLevels()
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	resp := &namedLevelsResp{
+		Global: GetLevel().String(),
+		Levels: make(map[string]string, len(levels)),
+	}
+	for _, name := range names {
+		resp.Levels[name] = levels[name].String()
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		Error(errorsx.Trace(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		Error(errorsx.Trace(err))
+	}
+}
@@ -0,0 +1,146 @@
+package log_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+)
+
+func TestNamedLevel(t *testing.T) {
+	output := &bufferOutput{}
+	parent := log.New(log.WithOutput(output))
+	sqlx := log.NamedFrom(parent, "sqlx")
+	tx := log.NamedFrom(sqlx, "tx")
+	other := log.NamedFrom(parent, "other")
+	defer log.UnsetLevelByName("sqlx")
+
+	tx.Debug("tx debug before")
+	log.SetLevelByName("sqlx", log.DebugLevel)
+	tx.Debug("tx debug after")
+	other.Debug("other debug")
+	if strings.Contains(output.String(), "tx debug before") ||
+		!strings.Contains(output.String(), `"logger":"sqlx.tx","msg":"tx debug after"`) ||
+		strings.Contains(output.String(), "other debug") {
+		t.Fatalf("unexpected output:%s", output.String())
+	}
+	if got := log.LevelOf(tx); got != log.DebugLevel {
+		t.Fatalf("expected:%s,got:%s", log.DebugLevel, got)
+	}
+
+	log.UnsetLevelByName("sqlx")
+	parent.SetLevel(log.WarnLevel)
+	tx.Info("tx info")
+	if strings.Contains(output.String(), "tx info") {
+		t.Fatalf("expected named logger to follow parent level, got:%s", output.String())
+	}
+}
+
+func TestNamedLevelConcurrentSetLevel(t *testing.T) {
+	parent := log.New(log.WithOutput(&bufferOutput{}))
+	named := log.NamedFrom(parent, "race")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			parent.SetLevel(log.DebugLevel)
+			parent.SetLevel(log.InfoLevel)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		named.Debug("debug")
+	}
+	<-done
+}
+
+func TestSetLevelConcurrentLogging(t *testing.T) {
+	logger := log.New(log.WithOutput(&bufferOutput{}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			logger.SetLevel(log.DebugLevel)
+			logger.SetStringLevel("info")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		logger.Info("info")
+	}
+	<-done
+}
+
+func TestNamedKeepsParentFields(t *testing.T) {
+	output := &bufferOutput{}
+	parent := log.New(log.WithOutput(output)).WithField("svc", "api")
+	log.NamedFrom(parent, "db").Info("query")
+	for _, expected := range []string{`"logger":"db"`, `"svc":"api"`} {
+		if !strings.Contains(output.String(), expected) {
+			t.Fatalf("expected:%s,got:%s", expected, output.String())
+		}
+	}
+}
+
+type customLogger struct {
+	log.Logger
+}
+
+func TestNamedFromCustomLogger(t *testing.T) {
+	output := &bufferOutput{}
+	logger := customLogger{log.New(log.WithOutput(output))}
+	log.NamedFrom(logger, "custom").Info("hello")
+	if !strings.Contains(output.String(), `"logger":"custom"`) {
+		t.Fatalf("expected:%s,got:%s", `"logger":"custom"`, output.String())
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	srv := httptest.NewServer(log.LevelHandler())
+	defer srv.Close()
+	defer log.UnsetLevelByName("sqlx")
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"?name=sqlx&level=debug", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &struct {
+		Global string            `json:"global"`
+		Levels map[string]string `json:"levels"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got.Levels["sqlx"] != "debug" || got.Global != log.GetLevel().String() {
+		t.Fatalf("unexpected levels:%+v", got)
+	}
+	if level := log.LevelByName("sqlx.tx"); level != log.DebugLevel {
+		t.Fatalf("expected:%s,got:%s", log.DebugLevel, level)
+	}
+
+	req, err = http.NewRequest(http.MethodDelete, srv.URL+"?name=sqlx", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if level := log.LevelByName("sqlx.tx"); level != log.GetLevel() {
+		t.Fatalf("expected:%s,got:%s", log.GetLevel(), level)
+	}
+}
+
+func TestLevelOfCustomLogger(t *testing.T) {
+	logger := customLogger{log.New(log.WithOutput(&bufferOutput{}))}
+	if got := log.LevelOf(logger); got != log.InfoLevel {
+		t.Fatalf("expected:%s,got:%s", log.InfoLevel, got)
+	}
+}
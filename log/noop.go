@@ -110,6 +110,11 @@ func (NoopLogger) SetLevel(Level) {}
 // SetStringLevel SetStringLevel
 func (NoopLogger) SetStringLevel(string) {}
 
+// GetLevel GetLevel
+func (NoopLogger) GetLevel() Level {
+	return InfoLevel
+}
+
 // Sync Sync
 func (NoopLogger) Sync() error {
 	return nil
@@ -134,3 +139,8 @@ func (NoopLogger) Close() error {
 func (l NoopLogger) WithStack() Logger {
 	return l
 }
+
+// Named Named
+func (l NoopLogger) Named(string) Logger {
+	return l
+}
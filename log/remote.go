@@ -0,0 +1,660 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"go.uber.org/zap/zapcore"
+)
+
+// RemoteTypes
+const (
+	SyslogRemoteType = "syslog"
+	TCPRemoteType    = "tcp"
+	UDPRemoteType    = "udp"
+	HTTPRemoteType   = "http"
+)
+
+// HTTPFormats
+const (
+	NDJSONHTTPFormat        = "ndjson"
+	ElasticsearchHTTPFormat = "elasticsearch"
+	LokiHTTPFormat          = "loki"
+)
+
+const (
+	spillSuffix = ".spill"
+	// syslogFacilityUser user-level messages
+	syslogFacilityUser = 1
+)
+
+// errs
+var (
+	ErrRemoteOutputClosed = errorsx.Std("remote output closed")
+	ErrRemoteStatus       = errorsx.Std("unexpected remote status")
+)
+
+// vars
+var (
+	DefaultRemoteBatchSize     = 100
+	DefaultRemoteMaxPending    = 10000
+	DefaultRemoteFlushInterval = time.Second
+	DefaultRemoteTimeout       = 5 * time.Second
+	DefaultRemoteMaxRetry      = 3
+	DefaultRemoteRetryBackoff  = 200 * time.Millisecond
+	DefaultRemoteSpillMaxSize  = "100mb"
+)
+
+// RemoteConf 发送到syslog(RFC5424),tcp/udp json行或http批量接口
+type RemoteConf struct {
+	Type string `toml:"type" yaml:"type" json:"type"`
+	// Addr syslog/tcp/udp为host:port,http为url
+	Addr string `toml:"addr" yaml:"addr" json:"addr"`
+	// Network syslog使用的传输协议,tcp或udp,默认tcp
+	Network string `toml:"network" yaml:"network" json:"network" nullable:"true"`
+	// Format http的body格式,ndjson,elasticsearch或loki,默认ndjson
+	Format string `toml:"format" yaml:"format" json:"format" nullable:"true"`
+	// Index elasticsearch bulk写入的index
+	Index string `toml:"index" yaml:"index" json:"index" nullable:"true"`
+	// Labels loki stream的labels
+	Labels map[string]string `toml:"labels" yaml:"labels" json:"labels" nullable:"true"`
+	// Facility syslog facility,0表示user
+	Facility int    `toml:"facility" yaml:"facility" json:"facility" nullable:"true"`
+	AppName  string `toml:"app_name" yaml:"app_name" json:"app_name" nullable:"true"`
+	// Headers http请求额外的header,如鉴权
+	Headers       map[string]string `toml:"headers" yaml:"headers" json:"headers" nullable:"true"`
+	BatchSize     int               `toml:"batch_size" yaml:"batch_size" json:"batch_size" nullable:"true"`
+	MaxPending    int               `toml:"max_pending" yaml:"max_pending" json:"max_pending" nullable:"true"`
+	FlushInterval string            `toml:"flush_interval" yaml:"flush_interval" json:"flush_interval" nullable:"true"`
+	Timeout       string            `toml:"timeout" yaml:"timeout" json:"timeout" nullable:"true"`
+	MaxRetry      int               `toml:"max_retry" yaml:"max_retry" json:"max_retry" nullable:"true"`
+	RetryBackoff  string            `toml:"retry_backoff" yaml:"retry_backoff" json:"retry_backoff" nullable:"true"`
+	// SpillDir 发送失败时暂存到磁盘的目录,恢复后优先重发,为空时直接丢弃
+	SpillDir     string `toml:"spill_dir" yaml:"spill_dir" json:"spill_dir" nullable:"true"`
+	SpillMaxSize string `toml:"spill_max_size" yaml:"spill_max_size" json:"spill_max_size" nullable:"true"`
+}
+
+func (c *RemoteConf) fill() {
+	if c.Network == "" {
+		c.Network = TCPRemoteType
+	}
+	if c.Format == "" {
+		c.Format = NDJSONHTTPFormat
+	}
+	if c.Facility <= 0 {
+		c.Facility = syslogFacilityUser
+	}
+	if c.AppName == "" {
+		c.AppName = filepath.Base(os.Args[0])
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultRemoteBatchSize
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = DefaultRemoteMaxPending
+	}
+	if c.FlushInterval == "" {
+		c.FlushInterval = DefaultRemoteFlushInterval.String()
+	}
+	if c.Timeout == "" {
+		c.Timeout = DefaultRemoteTimeout.String()
+	}
+	if c.MaxRetry <= 0 {
+		c.MaxRetry = DefaultRemoteMaxRetry
+	}
+	if c.RetryBackoff == "" {
+		c.RetryBackoff = DefaultRemoteRetryBackoff.String()
+	}
+	if c.SpillMaxSize == "" {
+		c.SpillMaxSize = DefaultRemoteSpillMaxSize
+	}
+}
+
+type remoteEntry struct {
+	Level zapcore.Level `json:"level"`
+	Time  time.Time     `json:"time"`
+	Data  string        `json:"data"`
+}
+
+// remoteSender 发送一批日志,失败时由调用方重试
+type remoteSender interface {
+	send(entries []*remoteEntry) error
+	close() error
+}
+
+// RemoteOutput 批量发送日志到远端,失败重试后暂存到磁盘
+type RemoteOutput struct {
+	typ           string
+	sender        remoteSender
+	batchSize     int
+	maxPending    int
+	flushInterval time.Duration
+	maxRetry      int
+	retryBackoff  time.Duration
+	spillDir      string
+	spillMaxSize  int64
+	pending       []*remoteEntry
+	closed        bool
+	notify        chan struct{}
+	syncCh        chan chan struct{}
+	done          chan struct{}
+	exited        chan struct{}
+	closeOnce     sync.Once
+	sync.Mutex
+}
+
+// NewRemoteOutput NewRemoteOutput
+func NewRemoteOutput(conf *RemoteConf) (*RemoteOutput, error) {
+	conf.fill()
+	timeout := parseDurationOr(conf.Timeout, DefaultRemoteTimeout)
+	var sender remoteSender
+	switch conf.Type {
+	case TCPRemoteType, UDPRemoteType:
+		sender = &streamSender{network: conf.Type, addr: conf.Addr, timeout: timeout}
+	case SyslogRemoteType:
+		hostname, _ := os.Hostname()
+		sender = &syslogSender{
+			streamSender: streamSender{network: conf.Network, addr: conf.Addr, timeout: timeout},
+			facility:     conf.Facility,
+			hostname:     hostname,
+			appName:      conf.AppName,
+			procID:       strconv.Itoa(os.Getpid()),
+		}
+	case HTTPRemoteType:
+		sender = &httpSender{
+			url:     conf.Addr,
+			format:  conf.Format,
+			index:   conf.Index,
+			labels:  conf.Labels,
+			headers: conf.Headers,
+			client:  &http.Client{Timeout: timeout},
+		}
+	default:
+		return nil, errorsx.New("unknown remote type").
+			WithField("type", conf.Type)
+	}
+	if conf.SpillDir != "" {
+		if err := os.MkdirAll(conf.SpillDir, 0755); err != nil {
+			return nil, errorsx.Trace(err).WithField("spill_dir", conf.SpillDir)
+		}
+	}
+	o := &RemoteOutput{
+		typ:           conf.Type,
+		sender:        sender,
+		batchSize:     conf.BatchSize,
+		maxPending:    conf.MaxPending,
+		flushInterval: parseDurationOr(conf.FlushInterval, DefaultRemoteFlushInterval),
+		maxRetry:      conf.MaxRetry,
+		retryBackoff:  parseDurationOr(conf.RetryBackoff, DefaultRemoteRetryBackoff),
+		spillDir:      conf.SpillDir,
+		spillMaxSize:  int64(parseSize(conf.SpillMaxSize)),
+		notify:        make(chan struct{}, 1),
+		syncCh:        make(chan chan struct{}),
+		done:          make(chan struct{}),
+		exited:        make(chan struct{}),
+	}
+	go o.run()
+	return o, nil
+}
+
+func parseDurationOr(val string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// Write 不带级别的写入按info处理,MaxPending满时丢弃
+func (o *RemoteOutput) Write(b []byte) (int, error) {
+	return o.WriteLevel(zapcore.InfoLevel, b)
+}
+
+// WriteLevel WriteLevel
+func (o *RemoteOutput) WriteLevel(level zapcore.Level, b []byte) (int, error) {
+	entry := &remoteEntry{
+		Level: level,
+		Time:  time.Now(),
+		Data:  strings.TrimRight(string(b), "\n"),
+	}
+	o.Lock()
+	if o.closed {
+		o.Unlock()
+		return 0, errorsx.Trace(ErrRemoteOutputClosed)
+	}
+	if len(o.pending) >= o.maxPending {
+		o.Unlock()
+		remoteDropped.WithLabelValues(o.typ).Inc()
+		return len(b), nil
+	}
+	o.pending = append(o.pending, entry)
+	full := len(o.pending) >= o.batchSize
+	o.Unlock()
+	if full {
+		select {
+		case o.notify <- struct{}{}:
+		default:
+		}
+	}
+	return len(b), nil
+}
+
+// Sync 立即发送缓冲的日志
+func (o *RemoteOutput) Sync() error {
+	ack := make(chan struct{})
+	select {
+	case o.syncCh <- ack:
+		<-ack
+	case <-o.exited:
+	}
+	return nil
+}
+
+// Close 发送缓冲的日志后关闭连接
+func (o *RemoteOutput) Close() error {
+	var err error
+	o.closeOnce.Do(func() {
+		o.Lock()
+		o.closed = true
+		o.Unlock()
+		close(o.done)
+		<-o.exited
+		if closeErr := o.sender.close(); closeErr != nil {
+			err = errorsx.Trace(closeErr)
+		}
+	})
+	return err
+}
+
+func (o *RemoteOutput) run() {
+	defer close(o.exited)
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.done:
+			o.flush()
+			return
+		case ack := <-o.syncCh:
+			o.flush()
+			close(ack)
+		case <-o.notify:
+			o.flush()
+		case <-ticker.C:
+			o.flush()
+		}
+	}
+}
+
+// flush 先重发磁盘上暂存的日志,远端仍不可用时新日志直接暂存,保证顺序
+func (o *RemoteOutput) flush() {
+	o.Lock()
+	pending := o.pending
+	o.pending = nil
+	o.Unlock()
+
+	available := o.replaySpills()
+	for len(pending) > 0 {
+		n := o.batchSize
+		if n > len(pending) {
+			n = len(pending)
+		}
+		batch := pending[:n]
+		pending = pending[n:]
+		if available {
+			err := o.sendWithRetry(batch)
+			if err == nil {
+				continue
+			}
+			reportError("remote", "failed to send logs to "+o.typ, err)
+			available = false
+		}
+		o.spill(batch)
+	}
+}
+
+func (o *RemoteOutput) sendWithRetry(batch []*remoteEntry) error {
+	var err error
+	for i := 0; i <= o.maxRetry; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(o.retryBackoff * time.Duration(1<<uint(i-1))):
+			case <-o.done:
+				// 关闭时不再退避,尽快暂存
+				return errorsx.Trace(err)
+			}
+		}
+		if err = o.sender.send(batch); err == nil {
+			remoteSent.WithLabelValues(o.typ).Add(float64(len(batch)))
+			return nil
+		}
+	}
+	return errorsx.Trace(err)
+}
+
+func (o *RemoteOutput) spillFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(o.spillDir, "*"+spillSuffix))
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// replaySpills 按写入顺序重发暂存的日志,返回远端是否可用
+func (o *RemoteOutput) replaySpills() bool {
+	if o.spillDir == "" {
+		return true
+	}
+	files, err := o.spillFiles()
+	if err != nil {
+		reportError("remote", "failed to list spill files", err)
+		return true
+	}
+	for _, file := range files {
+		entries, err := readSpill(file)
+		if err != nil {
+			reportError("remote", "failed to read spill file:"+file, err)
+			os.Remove(file)
+			continue
+		}
+		if err := o.sender.send(entries); err != nil {
+			return false
+		}
+		remoteSent.WithLabelValues(o.typ).Add(float64(len(entries)))
+		os.Remove(file)
+	}
+	return true
+}
+
+// spill 暂存到磁盘,超出SpillMaxSize时删除最早的文件,未配置SpillDir时丢弃
+func (o *RemoteOutput) spill(batch []*remoteEntry) {
+	if o.spillDir == "" {
+		remoteDropped.WithLabelValues(o.typ).Add(float64(len(batch)))
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	for _, entry := range batch {
+		if err := enc.Encode(entry); err != nil {
+			reportError("remote", "failed to encode spill entry", err)
+		}
+	}
+	name := fmt.Sprintf("%020d%s", time.Now().UnixNano(), spillSuffix)
+	tmp := filepath.Join(o.spillDir, name+".tmp")
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		reportError("remote", "failed to write spill file", err)
+		remoteDropped.WithLabelValues(o.typ).Add(float64(len(batch)))
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(o.spillDir, name)); err != nil {
+		os.Remove(tmp)
+		reportError("remote", "failed to rename spill file", err)
+		remoteDropped.WithLabelValues(o.typ).Add(float64(len(batch)))
+		return
+	}
+	remoteSpilled.WithLabelValues(o.typ).Add(float64(len(batch)))
+	o.trimSpills()
+}
+
+func (o *RemoteOutput) trimSpills() {
+	files, err := o.spillFiles()
+	if err != nil {
+		return
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, file := range files {
+		if fi, err := os.Stat(file); err == nil {
+			sizes[i] = fi.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(files)-1 && total > o.spillMaxSize; i++ {
+		if entries, err := readSpill(files[i]); err == nil {
+			remoteDropped.WithLabelValues(o.typ).Add(float64(len(entries)))
+		}
+		os.Remove(files[i])
+		total -= sizes[i]
+	}
+}
+
+func readSpill(file string) ([]*remoteEntry, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var entries []*remoteEntry
+	for dec.More() {
+		entry := &remoteEntry{}
+		if err := dec.Decode(entry); err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// streamSender tcp/udp每行一条json,tcp连接出错后下次发送时重连
+type streamSender struct {
+	network string
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func (s *streamSender) dial() (net.Conn, error) {
+	if s.conn != nil {
+		return s.conn, nil
+	}
+	conn, err := net.DialTimeout(s.network, s.addr, s.timeout)
+	if err != nil {
+		return nil, errorsx.Trace(err).WithField("addr", s.addr)
+	}
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *streamSender) write(frames [][]byte) error {
+	conn, err := s.dial()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := conn.SetWriteDeadline(time.Now().Add(s.timeout)); err != nil {
+		return errorsx.Trace(err)
+	}
+	if s.network == UDPRemoteType {
+		for _, frame := range frames {
+			if _, err := conn.Write(frame); err != nil {
+				s.close()
+				return errorsx.Trace(err)
+			}
+		}
+		return nil
+	}
+	if _, err := conn.Write(bytes.Join(frames, nil)); err != nil {
+		s.close()
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+func (s *streamSender) send(entries []*remoteEntry) error {
+	frames := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		frames = append(frames, []byte(entry.Data+"\n"))
+	}
+	return s.write(frames)
+}
+
+func (s *streamSender) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+// syslogSender RFC5424格式,tcp使用RFC6587的octet counting分帧
+type syslogSender struct {
+	streamSender
+	facility int
+	hostname string
+	appName  string
+	procID   string
+}
+
+func syslogSeverity(level zapcore.Level) int {
+	switch level {
+	case zapcore.DebugLevel:
+		return 7
+	case zapcore.InfoLevel:
+		return 6
+	case zapcore.WarnLevel:
+		return 4
+	case zapcore.ErrorLevel:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func syslogHeaderValue(val string) string {
+	if val == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, val)
+}
+
+func (s *syslogSender) format(entry *remoteEntry) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		s.facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderValue(s.hostname),
+		syslogHeaderValue(s.appName),
+		syslogHeaderValue(s.procID),
+		entry.Data)
+}
+
+func (s *syslogSender) send(entries []*remoteEntry) error {
+	frames := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		msg := s.format(entry)
+		if s.network == UDPRemoteType {
+			frames = append(frames, []byte(msg))
+			continue
+		}
+		frames = append(frames, []byte(strconv.Itoa(len(msg))+" "+msg))
+	}
+	return s.write(frames)
+}
+
+// httpSender 一批日志一个请求,非2xx视为失败
+type httpSender struct {
+	url     string
+	format  string
+	index   string
+	labels  map[string]string
+	headers map[string]string
+	client  *http.Client
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *httpSender) body(entries []*remoteEntry) ([]byte, string, error) {
+	buf := bytes.NewBuffer(nil)
+	switch s.format {
+	case LokiHTTPFormat:
+		stream := &lokiStream{Stream: s.labels, Values: make([][2]string, 0, len(entries))}
+		if stream.Stream == nil {
+			stream.Stream = map[string]string{}
+		}
+		for _, entry := range entries {
+			stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), entry.Data})
+		}
+		if err := json.NewEncoder(buf).Encode(&lokiPush{Streams: []*lokiStream{stream}}); err != nil {
+			return nil, "", errorsx.Trace(err)
+		}
+		return buf.Bytes(), "application/json", nil
+	case ElasticsearchHTTPFormat:
+		action, err := json.Marshal(map[string]map[string]string{"index": {"_index": s.index}})
+		if err != nil {
+			return nil, "", errorsx.Trace(err)
+		}
+		for _, entry := range entries {
+			buf.Write(action)
+			buf.WriteByte('\n')
+			buf.WriteString(entry.Data)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	default:
+		for _, entry := range entries {
+			buf.WriteString(entry.Data)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	}
+}
+
+func (s *httpSender) send(entries []*remoteEntry) error {
+	body, contentType, err := s.body(entries)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errorsx.Trace(ErrRemoteStatus).
+			WithField("status", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSender) close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
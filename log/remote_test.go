@@ -0,0 +1,127 @@
+package log_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/log/logtest"
+)
+
+func newRemoteLogger(t *testing.T, conf *log.RemoteConf) (log.Logger, *log.RemoteOutput) {
+	output, err := log.NewRemoteOutput(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log.New(log.WithOutput(output)), output
+}
+
+func TestRemoteStream(t *testing.T) {
+	for _, network := range []string{"tcp", "udp"} {
+		srv, err := logtest.NewServer(network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger, _ := newRemoteLogger(t, &log.RemoteConf{Type: network, Addr: srv.Addr})
+		logger.Info("first")
+		logger.Info("second")
+		if err := logger.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := srv.WaitLines(2, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(lines[0], `"msg":"first"`) || !strings.Contains(lines[1], `"msg":"second"`) {
+			t.Fatalf("%s: unexpected lines:%v", network, lines)
+		}
+		logger.Close()
+		srv.Close()
+	}
+}
+
+func TestRemoteSyslog(t *testing.T) {
+	srv, err := logtest.NewServer("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	logger, _ := newRemoteLogger(t, &log.RemoteConf{Type: log.SyslogRemoteType, Addr: srv.Addr, AppName: "demo"})
+	defer logger.Close()
+	logger.Warn("disk almost full")
+	logger.Sync()
+	lines, err := srv.WaitLines(1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// facility user(1)*8 + severity warning(4)
+	if !strings.HasPrefix(lines[0], "<12>1 ") ||
+		!strings.Contains(lines[0], " demo ") ||
+		!strings.Contains(lines[0], `"msg":"disk almost full"`) {
+		t.Fatalf("unexpected syslog message:%s", lines[0])
+	}
+}
+
+func TestRemoteHTTPSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	srv, err := logtest.NewServer("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	var reported []string
+	var reportedM sync.Mutex
+	log.SetErrorHandler(func(msg string, err error) {
+		reportedM.Lock()
+		defer reportedM.Unlock()
+		reported = append(reported, msg)
+	})
+	defer log.SetErrorHandler(nil)
+	srv.SetFailing(true)
+	logger, _ := newRemoteLogger(t, &log.RemoteConf{
+		Type:          log.HTTPRemoteType,
+		Addr:          srv.URL,
+		Format:        log.LokiHTTPFormat,
+		MaxRetry:      1,
+		RetryBackoff:  "10ms",
+		FlushInterval: "1h",
+		SpillDir:      dir,
+	})
+	defer logger.Close()
+
+	logger.Info("first")
+	logger.Info("second")
+	logger.Sync()
+	spills, _ := filepath.Glob(filepath.Join(dir, "*.spill"))
+	if len(spills) != 1 || srv.Requests() != 2 {
+		t.Fatalf("expected 1 spill file after 2 requests, got:%d,%d", len(spills), srv.Requests())
+	}
+	reportedM.Lock()
+	if len(reported) != 1 || reported[0] != "failed to send logs to "+log.HTTPRemoteType {
+		t.Fatalf("expected:%s,got:%v", "failed to send logs to "+log.HTTPRemoteType, reported)
+	}
+	reportedM.Unlock()
+
+	srv.SetFailing(false)
+	logger.Info("third")
+	logger.Sync()
+	lines := srv.Lines()
+	if len(lines) != 3 ||
+		!strings.Contains(lines[0], "first") ||
+		!strings.Contains(lines[1], "second") ||
+		!strings.Contains(lines[2], "third") {
+		t.Fatalf("expected spilled entries replayed in order, got:%v", lines)
+	}
+	if spills, _ := filepath.Glob(filepath.Join(dir, "*.spill")); len(spills) != 0 {
+		t.Fatalf("expected spill files removed, got:%v", spills)
+	}
+}
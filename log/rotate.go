@@ -0,0 +1,214 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wwq-2020/go.common/errorsx"
+)
+
+const (
+	compressSuffix = ".gz"
+)
+
+// rotateKeeper 轮转后维护软链接,并在后台压缩、清理旧文件
+type rotateKeeper struct {
+	file       string
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+	symlink    bool
+	current    string
+	ch         chan struct{}
+	done       chan struct{}
+	once       sync.Once
+	sync.Mutex
+}
+
+func newRotateKeeper(file string, rotateConf *RotateConf) *rotateKeeper {
+	k := &rotateKeeper{
+		file:       file,
+		maxBackups: rotateConf.MaxBackups,
+		compress:   rotateConf.Compress,
+		symlink:    rotateConf.Symlink,
+		ch:         make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	if rotateConf.MaxAge != "" {
+		maxAge, err := time.ParseDuration(rotateConf.MaxAge)
+		if err != nil {
+			Error(errorsx.Trace(err).WithField("max_age", rotateConf.MaxAge))
+		}
+		k.maxAge = maxAge
+	}
+	go k.run()
+	return k
+}
+
+// rotated current为新的输出文件,调用方持有输出的锁,不能在这里打日志
+func (k *rotateKeeper) rotated(current string) {
+	k.Lock()
+	k.current = current
+	k.Unlock()
+	select {
+	case <-k.done:
+		return
+	default:
+	}
+	select {
+	case k.ch <- struct{}{}:
+	default:
+	}
+}
+
+func (k *rotateKeeper) stop() {
+	k.once.Do(func() {
+		close(k.done)
+	})
+}
+
+// link 通过rename原子替换软链接,file已存在且不是软链接时不做处理
+func (k *rotateKeeper) link(current string) error {
+	if fi, err := os.Lstat(k.file); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return errorsx.New("symlink target exists and is not a symlink").
+			WithField("file", k.file)
+	}
+	tmp := k.file + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(current), tmp); err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := os.Rename(tmp, k.file); err != nil {
+		os.Remove(tmp)
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+func (k *rotateKeeper) run() {
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-k.ch:
+		}
+		if k.symlink {
+			k.Lock()
+			current := k.current
+			k.Unlock()
+			if err := k.link(current); err != nil {
+				Error(err)
+			}
+		}
+		if err := k.mill(); err != nil {
+			Error(err)
+		}
+	}
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// backups 默认FileFormatter生成的旧文件,以.文件名或.文件名.gz结尾,按修改时间倒序
+func (k *rotateKeeper) backups() ([]*backupFile, error) {
+	k.Lock()
+	current := k.current
+	k.Unlock()
+	dir := filepath.Dir(k.file)
+	base := filepath.Base(k.file)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	backups := make([]*backupFile, 0, len(infos))
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || name == base || name == filepath.Base(current) {
+			continue
+		}
+		if !strings.HasSuffix(name, "."+base) && !strings.HasSuffix(name, "."+base+compressSuffix) {
+			continue
+		}
+		backups = append(backups, &backupFile{path: filepath.Join(dir, name), modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	return backups, nil
+}
+
+func (k *rotateKeeper) mill() error {
+	backups, err := k.backups()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	remains := make([]*backupFile, 0, len(backups))
+	for i, backup := range backups {
+		expired := k.maxAge > 0 && time.Since(backup.modTime) > k.maxAge
+		if (k.maxBackups > 0 && i >= k.maxBackups) || expired {
+			if err := os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				Error(errorsx.Trace(err))
+			}
+			continue
+		}
+		remains = append(remains, backup)
+	}
+	if !k.compress {
+		return nil
+	}
+	for _, backup := range remains {
+		if strings.HasSuffix(backup.path, compressSuffix) {
+			continue
+		}
+		if err := compressFile(backup.path); err != nil {
+			Error(err)
+		}
+	}
+	return nil
+}
+
+// compressFile 压缩为src.gz并保留修改时间,完成后删除src
+func compressFile(src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	dst := src + compressSuffix
+	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return errorsx.Trace(err)
+	}
+	gz := gzip.NewWriter(gzf)
+	_, err = io.Copy(gz, f)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := gzf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return errorsx.Trace(err).WithField("file", src)
+	}
+	if err := os.Chtimes(dst, fi.ModTime(), fi.ModTime()); err != nil {
+		return errorsx.Trace(err)
+	}
+	if err := os.Remove(src); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// vars
+var (
+	DefaultSamplingInterval = time.Second
+)
+
+// SamplingConf 同一级别同一消息在每个周期内先输出First条,之后每Thereafter条输出一条,
+// 再经过RateLimit限制每个周期最多输出的条数,被丢弃的条数在周期结束后汇总输出一条
+type SamplingConf struct {
+	// Level 生效的级别,为空时对所有级别生效
+	Level      string `toml:"level" yaml:"level" json:"level" nullable:"true"`
+	Interval   string `toml:"interval" yaml:"interval" json:"interval" nullable:"true"`
+	First      int    `toml:"first" yaml:"first" json:"first" nullable:"true"`
+	Thereafter int    `toml:"thereafter" yaml:"thereafter" json:"thereafter" nullable:"true"`
+	// RateLimit 每个周期最多输出的条数,0表示不限制
+	RateLimit int `toml:"rate_limit" yaml:"rate_limit" json:"rate_limit" nullable:"true"`
+}
+
+func (c *SamplingConf) fill() {
+	if c.Interval == "" {
+		c.Interval = DefaultSamplingInterval.String()
+	}
+}
+
+// WithSampling WithSampling
+func WithSampling(confs ...*SamplingConf) Option {
+	return func(o *Options) {
+		o.sampling = append(o.sampling[:len(o.sampling):len(o.sampling)], confs...)
+	}
+}
+
+type sampleCounter struct {
+	count      int
+	passed     int
+	suppressed int
+	level      zapcore.Level
+	msg        string
+}
+
+type samplePolicy struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	rateLimit  int
+	windowEnd  time.Time
+	counters   map[string]*sampleCounter
+	// timer 周期内有丢弃时在周期结束后输出汇总,之后没有新日志也不会丢失汇总
+	timer   *time.Timer
+	sampler *sampler
+	sync.Mutex
+}
+
+func buildSamplePolicy(conf *SamplingConf) *samplePolicy {
+	conf.fill()
+	interval, err := time.ParseDuration(conf.Interval)
+	if err != nil || interval <= 0 {
+		interval = DefaultSamplingInterval
+	}
+	return &samplePolicy{
+		interval:   interval,
+		first:      conf.First,
+		thereafter: conf.Thereafter,
+		rateLimit:  conf.RateLimit,
+		counters:   make(map[string]*sampleCounter),
+	}
+}
+
+// allow 返回当前日志是否输出,以及上个周期内被丢弃的汇总
+func (p *samplePolicy) allow(ent zapcore.Entry) (bool, []*sampleCounter) {
+	p.Lock()
+	defer p.Unlock()
+	var summaries []*sampleCounter
+	if !ent.Time.Before(p.windowEnd) {
+		// 汇总已在此处输出,旧周期的timer不再需要
+		if p.timer != nil {
+			p.timer.Stop()
+			p.timer = nil
+		}
+		summaries = p.drain()
+		p.counters = make(map[string]*sampleCounter)
+		p.windowEnd = ent.Time.Add(p.interval)
+	}
+	key := ent.Level.String() + ":" + ent.Message
+	counter, exist := p.counters[key]
+	if !exist {
+		counter = &sampleCounter{level: ent.Level, msg: ent.Message}
+		p.counters[key] = counter
+	}
+	counter.count++
+	sampled := p.first <= 0 && p.thereafter <= 0 ||
+		counter.count <= p.first ||
+		p.thereafter > 0 && (counter.count-p.first)%p.thereafter == 0
+	if sampled && (p.rateLimit <= 0 || counter.passed < p.rateLimit) {
+		counter.passed++
+		return true, summaries
+	}
+	counter.suppressed++
+	sampledDropped.WithLabelValues(ent.Level.String()).Inc()
+	if p.timer == nil {
+		p.timer = time.AfterFunc(time.Until(p.windowEnd), p.flush)
+	}
+	return false, summaries
+}
+
+// drain 返回有丢弃的汇总并清零,调用方持有锁
+func (p *samplePolicy) drain() []*sampleCounter {
+	var summaries []*sampleCounter
+	for _, counter := range p.counters {
+		if counter.suppressed == 0 {
+			continue
+		}
+		summaries = append(summaries, &sampleCounter{
+			level:      counter.level,
+			msg:        counter.msg,
+			suppressed: counter.suppressed,
+		})
+		counter.suppressed = 0
+	}
+	return summaries
+}
+
+func (p *samplePolicy) flush() {
+	p.Lock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	summaries := p.drain()
+	p.Unlock()
+	now := time.Now()
+	for _, summary := range summaries {
+		p.sampler.summary(now, summary)
+	}
+}
+
+type sampler struct {
+	root     zapcore.Core
+	policies map[zapcore.Level]*samplePolicy
+}
+
+// samplingCore 按级别采样与限流,summary通过root core输出,不带With添加的字段
+type samplingCore struct {
+	zapcore.Core
+	sampler *sampler
+}
+
+func newSamplingCore(core zapcore.Core, confs []*SamplingConf) zapcore.Core {
+	policies := make(map[zapcore.Level]*samplePolicy)
+	sampler := &sampler{root: core, policies: policies}
+	for _, conf := range confs {
+		policy := buildSamplePolicy(conf)
+		policy.sampler = sampler
+		if conf.Level == "" {
+			for level := zapcore.DebugLevel; level <= zapcore.FatalLevel; level++ {
+				if _, exist := policies[level]; !exist {
+					policies[level] = policy
+				}
+			}
+			continue
+		}
+		level, err := ParseLevel(conf.Level)
+		if err != nil {
+			continue
+		}
+		policies[level.toZapLevel().Level()] = policy
+	}
+	return &samplingCore{
+		Core:    core,
+		sampler: sampler,
+	}
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplingCore{
+		Core:    c.Core.With(fields),
+		sampler: c.sampler,
+	}
+}
+
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	policy, exist := c.sampler.policies[ent.Level]
+	if !exist {
+		return c.Core.Check(ent, ce)
+	}
+	allowed, summaries := policy.allow(ent)
+	for _, summary := range summaries {
+		c.sampler.summary(ent.Time, summary)
+	}
+	if !allowed {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Sync 先输出当前周期的汇总
+func (c *samplingCore) Sync() error {
+	flushed := make(map[*samplePolicy]struct{}, len(c.sampler.policies))
+	for _, policy := range c.sampler.policies {
+		if _, exist := flushed[policy]; exist {
+			continue
+		}
+		flushed[policy] = struct{}{}
+		policy.flush()
+	}
+	return c.Core.Sync()
+}
+
+func (s *sampler) summary(t time.Time, counter *sampleCounter) {
+	ent := zapcore.Entry{
+		Level:   counter.level,
+		Time:    t,
+		Message: "suppressed similar log entries",
+	}
+	if ce := s.root.Check(ent, nil); ce != nil {
+		ce.Write(
+			zap.String("suppressedMsg", counter.msg),
+			zap.Int("suppressed", counter.suppressed),
+		)
+	}
+}
@@ -0,0 +1,104 @@
+package log_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wwq-2020/go.common/log"
+)
+
+type bufferOutput struct {
+	buf bytes.Buffer
+	sync.Mutex
+}
+
+func (o *bufferOutput) Write(b []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	return o.buf.Write(b)
+}
+
+func (o *bufferOutput) String() string {
+	o.Lock()
+	defer o.Unlock()
+	return o.buf.String()
+}
+
+func (o *bufferOutput) Bytes() []byte {
+	return []byte(o.String())
+}
+
+func (o *bufferOutput) Reset() {
+	o.Lock()
+	defer o.Unlock()
+	o.buf.Reset()
+}
+
+func (o *bufferOutput) Close() error {
+	return nil
+}
+
+func TestSampling(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output), log.WithSampling(&log.SamplingConf{
+		Level:      "warn",
+		Interval:   "100ms",
+		First:      2,
+		Thereafter: 3,
+		RateLimit:  3,
+	}))
+	for i := 0; i < 20; i++ {
+		logger.Warn("hot path")
+		logger.Info("not sampled")
+	}
+	// 第1、2、5条通过采样,第8条超出限流
+	if got := strings.Count(output.String(), `"msg":"hot path"`); got != 3 {
+		t.Fatalf("expected 3 sampled entries, got:%d", got)
+	}
+	if got := strings.Count(output.String(), `"msg":"not sampled"`); got != 20 {
+		t.Fatalf("expected 20 info entries, got:%d", got)
+	}
+	time.Sleep(150 * time.Millisecond)
+	logger.Warn("hot path")
+	if !strings.Contains(output.String(), `"msg":"suppressed similar log entries","suppressedMsg":"hot path","suppressed":17`) {
+		t.Fatalf("expected summary line, got:%s", output.String())
+	}
+}
+
+func TestSamplingSummaryWithoutLaterEntries(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output), log.WithSampling(&log.SamplingConf{
+		Interval: "50ms",
+		First:    1,
+	}))
+	for i := 0; i < 5; i++ {
+		logger.Warn("burst")
+	}
+	expected := `"suppressedMsg":"burst","suppressed":4`
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(output.String(), expected) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected:%s,got:%s", expected, output.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSamplingSummaryOnSync(t *testing.T) {
+	output := &bufferOutput{}
+	logger := log.New(log.WithOutput(output), log.WithSampling(&log.SamplingConf{
+		Interval: "1h",
+		First:    1,
+	}))
+	for i := 0; i < 5; i++ {
+		logger.Warn("burst")
+	}
+	logger.Sync()
+	expected := `"suppressedMsg":"burst","suppressed":4`
+	if !strings.Contains(output.String(), expected) {
+		t.Fatalf("expected:%s,got:%s", expected, output.String())
+	}
+}
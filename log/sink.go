@@ -0,0 +1,292 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wwq-2020/go.common/errorsx"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Encoding Encoding
+type Encoding string
+
+// Encodings
+const (
+	JSONEncoding    Encoding = "json"
+	ConsoleEncoding Encoding = "console"
+	LogfmtEncoding  Encoding = "logfmt"
+)
+
+// Outputs
+const (
+	StdoutOutput     = "stdout"
+	StderrOutput     = "stderr"
+	RemoteOutputName = "remote"
+)
+
+// Sink 一个输出及其最低日志级别与编码
+type Sink struct {
+	Output   io.WriteCloser
+	Level    Level
+	Encoding Encoding
+}
+
+// WithSink 添加输出,配置了sink时不再使用WithOutput的output
+func WithSink(output io.WriteCloser, level Level, encoding Encoding) Option {
+	return func(o *Options) {
+		o.sinks = append(o.sinks[:len(o.sinks):len(o.sinks)], &Sink{
+			Output:   output,
+			Level:    level,
+			Encoding: encoding,
+		})
+	}
+}
+
+// WithSinks WithSinks
+func WithSinks(sinks ...*Sink) Option {
+	return func(o *Options) {
+		o.sinks = append(o.sinks[:len(o.sinks):len(o.sinks)], sinks...)
+	}
+}
+
+// SinkConf SinkConf
+type SinkConf struct {
+	// Output stdout,stderr,remote或文件路径
+	Output   string      `toml:"output" yaml:"output" json:"output"`
+	Level    string      `toml:"level" yaml:"level" json:"level" nullable:"true"`
+	Encoding Encoding    `toml:"encoding" yaml:"encoding" json:"encoding" nullable:"true"`
+	Rotate   *RotateConf `toml:"rotate" yaml:"rotate" json:"rotate" nullable:"true"`
+	Async    *AsyncConf  `toml:"async" yaml:"async" json:"async" nullable:"true"`
+	// Remote output为remote时发送到远端
+	Remote *RemoteConf `toml:"remote" yaml:"remote" json:"remote" nullable:"true"`
+}
+
+func (c *SinkConf) fill() {
+	if c.Level == "" {
+		c.Level = DebugLevel.String()
+	}
+	if c.Encoding != JSONEncoding &&
+		c.Encoding != ConsoleEncoding &&
+		c.Encoding != LogfmtEncoding {
+		c.Encoding = JSONEncoding
+	}
+}
+
+// Conf Conf
+type Conf struct {
+	// Level 全局日志级别,为空时取sinks中最低的级别
+	Level    string          `toml:"level" yaml:"level" json:"level" nullable:"true"`
+	Sinks    []*SinkConf     `toml:"sinks" yaml:"sinks" json:"sinks"`
+	Sampling []*SamplingConf `toml:"sampling" yaml:"sampling" json:"sampling" nullable:"true"`
+	Format   *FormatConf     `toml:"format" yaml:"format" json:"format" nullable:"true"`
+}
+
+// BuildSink BuildSink
+func BuildSink(conf *SinkConf) (*Sink, error) {
+	conf.fill()
+	level, err := ParseLevel(conf.Level)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	var output io.WriteCloser
+	switch {
+	case conf.Output == StdoutOutput:
+		output = os.Stdout
+	case conf.Output == StderrOutput:
+		output = os.Stderr
+	case conf.Output == "":
+		return nil, errorsx.New("empty sink output")
+	case conf.Output == RemoteOutputName:
+		if conf.Remote == nil {
+			return nil, errorsx.New("empty remote conf")
+		}
+		remote, err := NewRemoteOutput(conf.Remote)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+		output = remote
+	case conf.Rotate != nil:
+		output = BuildRotatedOutput(conf.Output, conf.Rotate)
+	default:
+		f, err := os.OpenFile(conf.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, errorsx.Trace(err).WithField("output", conf.Output)
+		}
+		output = f
+	}
+	if conf.Async != nil {
+		output = NewAsyncOutput(output, conf.Async)
+	}
+	return &Sink{
+		Output:   output,
+		Level:    level,
+		Encoding: conf.Encoding,
+	}, nil
+}
+
+// NewFromConf NewFromConf
+func NewFromConf(conf *Conf, opts ...Option) (Logger, error) {
+	sinks := make([]*Sink, 0, len(conf.Sinks))
+	for _, sinkConf := range conf.Sinks {
+		sink, err := BuildSink(sinkConf)
+		if err != nil {
+			for _, sink := range sinks {
+				closeSinkOutput(sink.Output)
+			}
+			return nil, errorsx.Trace(err)
+		}
+		sinks = append(sinks, sink)
+	}
+	level := InfoLevel
+	if conf.Level != "" {
+		var err error
+		level, err = ParseLevel(conf.Level)
+		if err != nil {
+			return nil, errorsx.Trace(err)
+		}
+	} else if len(sinks) > 0 {
+		level = PanicLevel
+		for _, sink := range sinks {
+			if sink.Level > level {
+				level = sink.Level
+			}
+		}
+	}
+	opts = append([]Option{WithSinks(sinks...), WithSampling(conf.Sampling...), withLevel(level)}, opts...)
+	if conf.Format != nil {
+		opts = append([]Option{WithFormat(conf.Format)}, opts...)
+	}
+	return New(opts...), nil
+}
+
+func withLevel(level Level) Option {
+	return func(o *Options) {
+		o.level.Store(level)
+	}
+}
+
+// closeSinkOutput 标准输出不关闭
+func closeSinkOutput(output io.WriteCloser) error {
+	if output == os.Stdout || output == os.Stderr {
+		return nil
+	}
+	if err := output.Close(); err != nil {
+		return errorsx.Trace(err)
+	}
+	return nil
+}
+
+func buildEncoder(encoding Encoding, cfg zapcore.EncoderConfig) zapcore.Encoder {
+	switch encoding {
+	case ConsoleEncoding:
+		return zapcore.NewConsoleEncoder(cfg)
+	case LogfmtEncoding:
+		return newLogfmtEncoder(cfg)
+	default:
+		return zapcore.NewJSONEncoder(cfg)
+	}
+}
+
+func buildCore(encoder zapcore.Encoder, output io.Writer, enab zapcore.LevelEnabler) zapcore.Core {
+	if output, ok := output.(levelWriter); ok {
+		return newLevelCore(encoder, output, enab)
+	}
+	return zapcore.NewCore(encoder, zapcore.Lock(zapcore.AddSync(output)), enab)
+}
+
+// buildTeeCore 全局级别由外层的levelFilterCore过滤,这里只按sink级别过滤
+func buildTeeCore(options *Options) zapcore.Core {
+	cfg := buildEncoderConfig(options.format)
+	cores := make([]zapcore.Core, 0, len(options.sinks))
+	for _, sink := range options.sinks {
+		cores = append(cores, buildCore(buildEncoder(sink.Encoding, cfg), sink.Output, sink.Level.toZapLevel()))
+	}
+	return zapcore.NewTee(cores...)
+}
+
+// logfmtEncoder 复用json encoder累积字段,输出时按原有顺序转换为key=value
+type logfmtEncoder struct {
+	zapcore.Encoder
+}
+
+func newLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &logfmtEncoder{Encoder: zapcore.NewJSONEncoder(cfg)}
+}
+
+func (e *logfmtEncoder) Clone() zapcore.Encoder {
+	return &logfmtEncoder{Encoder: e.Encoder.Clone()}
+}
+
+func (e *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return nil, errorsx.Trace(err)
+	}
+	defer buf.Free()
+	out := logfmtPool.Get()
+	if err := json2Logfmt(buf.Bytes(), out); err != nil {
+		out.Free()
+		return nil, errorsx.Trace(err)
+	}
+	return out, nil
+}
+
+var (
+	logfmtPool = buffer.NewPool()
+)
+
+func json2Logfmt(data []byte, out *buffer.Buffer) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil {
+		return errorsx.Trace(err)
+	}
+	first := true
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return errorsx.Trace(err)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return errorsx.Trace(err)
+		}
+		if !first {
+			out.AppendByte(' ')
+		}
+		first = false
+		out.AppendString(token.(string))
+		out.AppendByte('=')
+		var val string
+		if len(raw) > 0 && raw[0] == '"' {
+			if err := json.Unmarshal(raw, &val); err != nil {
+				return errorsx.Trace(err)
+			}
+		} else {
+			val = string(raw)
+		}
+		out.AppendString(quoteLogfmt(val))
+	}
+	out.AppendString(zapcore.DefaultLineEnding)
+	return nil
+}
+
+func quoteLogfmt(val string) string {
+	if val == "" {
+		return `""`
+	}
+	needQuote := strings.IndexFunc(val, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r)
+	}) >= 0
+	if needQuote {
+		return strconv.Quote(val)
+	}
+	return val
+}
@@ -0,0 +1,70 @@
+package log_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wwq-2020/go.common/confx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+func TestNewFromConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	all := filepath.Join(dir, "all.log")
+	errs := filepath.Join(dir, "error.log")
+	data := fmt.Sprintf(`
+[log]
+[[log.sinks]]
+output = %q
+level = "info"
+
+[[log.sinks]]
+output = %q
+level = "error"
+encoding = "logfmt"
+`, all, errs)
+	conf := &struct {
+		Log *log.Conf `toml:"log"`
+	}{}
+	if err := confx.Parse([]byte(data), conf); err != nil {
+		t.Fatal(err)
+	}
+	logger, err := log.NewFromConf(conf.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("debug msg")
+	logger.WithField("user", "a b").Info("info msg")
+	logger.Error(errors.New("error msg"))
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	allData, err := ioutil.ReadFile(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(allData), "debug msg") ||
+		!strings.Contains(string(allData), `"msg":"info msg"`) ||
+		!strings.Contains(string(allData), "error msg") {
+		t.Fatalf("unexpected json sink output:%s", allData)
+	}
+	errData, err := ioutil.ReadFile(errs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(errData), "info msg") ||
+		!strings.Contains(string(errData), "level=error") ||
+		!strings.Contains(string(errData), `msg="error msg"`) {
+		t.Fatalf("unexpected logfmt sink output:%s", errData)
+	}
+}
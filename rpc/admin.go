@@ -0,0 +1,153 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/wwq-2020/go.common/app"
+	"github.com/wwq-2020/go.common/confx"
+	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
+)
+
+// admin paths
+const (
+	AdminPprofPath      = "/debug/pprof/"
+	AdminRoutesPath     = "/admin/routes"
+	AdminLogLevelPath   = "/admin/loglevel"
+	AdminLogLevelsPath  = "/admin/loglevels"
+	AdminConfPath       = "/admin/conf"
+	AdminBuildInfoPath  = "/admin/buildinfo"
+	AdminGoroutinesPath = "/admin/goroutines"
+)
+
+// AdminConf AdminConf
+type AdminConf struct {
+	Addr string `toml:"addr" yaml:"addr" json:"addr"`
+}
+
+func (c *AdminConf) fill() {
+	if c.Addr == "" {
+		c.Addr = defaultAdminConf.Addr
+	}
+}
+
+var defaultAdminConf = &AdminConf{
+	Addr: "127.0.0.1:8081",
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type goroutines struct {
+	Total int   `json:"total"`
+	App   int64 `json:"app"`
+}
+
+type buildInfo struct {
+	GoVersion string          `json:"go_version"`
+	Path      string          `json:"path,omitempty"`
+	Main      *debug.Module   `json:"main,omitempty"`
+	Deps      []*debug.Module `json:"deps,omitempty"`
+}
+
+// NewAdminHandler NewAdminHandler
+func NewAdminHandler(router Router, conf interface{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminPprofPath, pprof.Index)
+	mux.HandleFunc(AdminPprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(AdminPprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(AdminPprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(AdminPprofPath+"trace", pprof.Trace)
+	mux.HandleFunc(AdminRoutesPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		lister, ok := router.(RouteLister)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		writeAdminResp(w, lister.Routes())
+	})
+	mux.HandleFunc(AdminLogLevelPath, handleLogLevel)
+	mux.Handle(AdminLogLevelsPath, log.LevelHandler())
+	mux.HandleFunc(AdminConfPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminResp(w, confx.Snapshot(conf, "toml"))
+	})
+	mux.HandleFunc(AdminBuildInfoPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		info := &buildInfo{GoVersion: runtime.Version()}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			info.Path = bi.Path
+			info.Main = &bi.Main
+			info.Deps = bi.Deps
+		}
+		writeAdminResp(w, info)
+	})
+	mux.HandleFunc(AdminGoroutinesPath, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminResp(w, &goroutines{
+			Total: runtime.NumGoroutine(),
+			App:   app.Running(),
+		})
+	})
+	return mux
+}
+
+func handleLogLevel(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeAdminResp(w, &logLevel{Level: log.GetLevel().String()})
+	case http.MethodPut:
+		level := req.URL.Query().Get("level")
+		if level == "" {
+			obj := &logLevel{}
+			if err := json.NewDecoder(req.Body).Decode(obj); err != nil {
+				log.Error(errorsx.Trace(err))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			level = obj.Level
+		}
+		if _, err := log.ParseLevel(level); err != nil {
+			log.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.SetStringLevel(level)
+		log.WithField("level", level).
+			Warn("log level changed")
+		writeAdminResp(w, &logLevel{Level: log.GetLevel().String()})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeAdminResp(w http.ResponseWriter, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		log.Error(errorsx.Trace(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Error(errorsx.Trace(err))
+	}
+}
@@ -0,0 +1,66 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wwq-2020/go.common/log"
+	"github.com/wwq-2020/go.common/rpc"
+)
+
+func TestAdminHandler(t *testing.T) {
+	router := rpc.NewRouter()
+	router.Handle("/a", http.NotFoundHandler())
+	conf := &struct {
+		Addr     string `toml:"addr"`
+		Password string `toml:"password"`
+	}{
+		Addr:     "127.0.0.1:8080",
+		Password: "xx",
+	}
+	srv := httptest.NewServer(rpc.NewAdminHandler(router, conf))
+	defer srv.Close()
+
+	routes := []string{}
+	resp, err := http.Get(srv.URL + rpc.AdminRoutesPath)
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&routes); err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp.Body.Close()
+	if len(routes) != 1 || routes[0] != "/a" {
+		t.Fatalf("expected:[/a],got:%v", routes)
+	}
+
+	gotConf := map[string]string{}
+	resp, err = http.Get(srv.URL + rpc.AdminConfPath)
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&gotConf); err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp.Body.Close()
+	if gotConf["password"] == conf.Password {
+		t.Fatalf("expected:masked,got:%s", gotConf["password"])
+	}
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+rpc.AdminLogLevelPath, strings.NewReader(`{"level":"debug"}`))
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected:nil,got:%v", err)
+	}
+	resp.Body.Close()
+	defer log.SetLevel(log.InfoLevel)
+	if got := log.GetLevel(); got != log.DebugLevel {
+		t.Fatalf("expected:%s,got:%s", log.DebugLevel, got)
+	}
+}
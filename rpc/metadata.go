@@ -85,6 +85,8 @@ func ContextWithOutgoingMetadata(ctx context.Context, givenMetadata Metadata) co
 const (
 	LdapKey  = "ldap"
 	TokenKey = "token"
+	// CallerKey 调用方服务名
+	CallerKey = "caller"
 )
 
 // LdapFromIncomingContext LdapFromIncomingContext
@@ -134,3 +136,27 @@ func OutgoingContextWithLdap(ctx context.Context, ldap string) context.Context {
 	metadata := NewMetadata().Add(LdapKey, ldap)
 	return ContextWithOutgoingMetadata(ctx, metadata)
 }
+
+// CallerFromIncomingContext CallerFromIncomingContext
+func CallerFromIncomingContext(ctx context.Context) string {
+	metadata := IncomingMetadataFromContext(ctx)
+	return metadata.Get(CallerKey)
+}
+
+// IncomingContextWithCaller IncomingContextWithCaller
+func IncomingContextWithCaller(ctx context.Context, caller string) context.Context {
+	metadata := NewMetadata().Add(CallerKey, caller)
+	return ContextWithIncomingMetadata(ctx, metadata)
+}
+
+// CallerFromOutgoingContext CallerFromOutgoingContext
+func CallerFromOutgoingContext(ctx context.Context) string {
+	metadata := OutgoingMetadataFromContext(ctx)
+	return metadata.Get(CallerKey)
+}
+
+// OutgoingContextWithCaller OutgoingContextWithCaller
+func OutgoingContextWithCaller(ctx context.Context, caller string) context.Context {
+	metadata := NewMetadata().Add(CallerKey, caller)
+	return ContextWithOutgoingMetadata(ctx, metadata)
+}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"fmt"
 	"net/http"
+	"sort"
 )
 
 // Router Router
@@ -12,6 +13,11 @@ type Router interface {
 	HandleNotFound(handler http.Handler) Router
 }
 
+// RouteLister 可选实现,用于admin列出已注册的路由
+type RouteLister interface {
+	Routes() []string
+}
+
 // RouterFactory RouterFactory
 type RouterFactory func() Router
 
@@ -57,3 +63,12 @@ func (r *router) HandleNotFound(handler http.Handler) Router {
 	r.NotFoundHandler = handler
 	return r
 }
+
+func (r *router) Routes() []string {
+	routes := make([]string, 0, len(r.m))
+	for path := range r.m {
+		routes = append(routes, path)
+	}
+	sort.Strings(routes)
+	return routes
+}
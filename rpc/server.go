@@ -1,9 +1,8 @@
 package rpc
 
 import (
-	"bytes"
 	"context"
-	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,7 +14,6 @@ import (
 	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/rpc/interceptor"
 	"github.com/wwq-2020/go.common/stack"
-	"github.com/wwq-2020/go.common/tracing"
 	"google.golang.org/grpc"
 )
 
@@ -40,20 +38,24 @@ type Server interface {
 }
 
 type server struct {
-	name    string
-	addr    string
-	server  *http.Server
-	options ServerOptions
-	router  Router
+	name        string
+	addr        string
+	server      *http.Server
+	adminServer *http.Server
+	options     ServerOptions
+	router      Router
 }
 
 // ServerConf ServerConf
 type ServerConf struct {
-	Addr string `toml:"addr" yaml:"addr" json:"addr"`
+	Addr  string     `toml:"addr" yaml:"addr" json:"addr"`
+	Admin *AdminConf `toml:"admin" yaml:"admin" json:"admin" nullable:"true"`
 }
 
 func (c *ServerConf) fill() {
-
+	if c.Admin != nil {
+		c.Admin.fill()
+	}
 }
 
 var defaultServerConf = &ServerConf{
@@ -71,6 +73,13 @@ func NewServer(conf *ServerConf, opts ...ServerOption) Server {
 		opt(&options)
 	}
 	wrappedHandler := wrapHTTPHandler(options.router)
+	var adminServer *http.Server
+	if conf.Admin != nil {
+		adminServer = &http.Server{
+			Addr:    conf.Admin.Addr,
+			Handler: NewAdminHandler(options.router, options.conf),
+		}
+	}
 	return &server{
 		addr:   conf.Addr,
 		router: options.router,
@@ -78,12 +87,27 @@ func NewServer(conf *ServerConf, opts ...ServerOption) Server {
 			Addr:    conf.Addr,
 			Handler: wrappedHandler,
 		},
-		options: options,
+		adminServer: adminServer,
+		options:     options,
 	}
 }
 
 // Start Start
 func (s *server) Start() error {
+	if s.adminServer != nil {
+		// 同步监听,端口冲突等错误直接由Start返回
+		ln, err := net.Listen("tcp", s.adminServer.Addr)
+		if err != nil {
+			return errorsx.Trace(err).
+				WithField("addr", s.adminServer.Addr)
+		}
+		go func() {
+			if err := s.adminServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.WithField("addr", s.adminServer.Addr).
+					Error(err)
+			}
+		}()
+	}
 	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return errorsx.Trace(err)
 	}
@@ -92,6 +116,12 @@ func (s *server) Start() error {
 
 // Stop Stop
 func (s *server) Stop(ctx context.Context) error {
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			log.WithField("addr", s.adminServer.Addr).
+				Error(err)
+		}
+	}
 	if err := s.server.Shutdown(ctx); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -204,10 +234,11 @@ func (s *server) WithCodec(codec Codec) Server {
 	options := s.options
 	options.codec = codec
 	return &server{
-		addr:    s.addr,
-		server:  s.server,
-		options: options,
-		router:  s.router,
+		addr:        s.addr,
+		server:      s.server,
+		adminServer: s.adminServer,
+		options:     options,
+		router:      s.router,
 	}
 }
 
@@ -222,26 +253,6 @@ func gprcMethodDescToMethodHandler(method grpc.MethodDesc, ss interface{}) inter
 	}
 }
 
-type responseWriter struct {
-	http.ResponseWriter
-	buffer     *bytes.Buffer
-	statusCode int
-}
-
-func (rw *responseWriter) WriteHeader(statusCode int) {
-	rw.ResponseWriter.WriteHeader(statusCode)
-	rw.statusCode = statusCode
-}
-
-func (rw *responseWriter) Write(data []byte) (int, error) {
-	n, err := rw.ResponseWriter.Write(data)
-	if err != nil {
-		return 0, errorsx.Trace(err)
-	}
-	rw.buffer.Write(data[:n])
-	return n, nil
-}
-
 // WrapHTTPHandler WrapHTTPHandler
 func WrapHTTPHandler(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
@@ -257,75 +268,33 @@ func wrapHTTPHandler(handler http.Handler) http.Handler {
 	return wrappedHandler
 }
 
-func defaultChainedHTTPMiddleware() httpMiddleware {
-	return chainedHTTPMiddleware(trace, metrics, recovery)
+func defaultChainedHTTPMiddleware() httpx.Middleware {
+	return httpx.ChainMiddleware(httpx.TraceMiddlewareEx(traceOptions), metrics, httpx.RecoveryMiddleware)
 }
 
-func chainedHTTPMiddleware(middlewares ...httpMiddleware) httpMiddleware {
-	return func(handler http.Handler) http.Handler {
-		chainedHandler := handler
-		for i := len(middlewares) - 1; i >= 0; i-- {
-			chainedHandler = middlewares[i](chainedHandler)
-		}
-		return chainedHandler
-	}
-}
-
-type httpMiddleware func(http.Handler) http.Handler
-
-func trace(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		ctx := req.Context()
-		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-		defer cancel()
-		span, ctx := tracing.HTTPServerStartSpan(ctx, "serve", req, w)
+var traceOptions = httpx.TraceOptions{
+	Timeout: time.Second * 30,
+	LogBody: true,
+	// 请求内的*Context日志都会带上这些字段,caller键已用于日志的调用位置,
+	// 调用方服务名记在rpcCaller
+	Context: func(ctx context.Context, req *http.Request) context.Context {
 		ctx = ContextWithIncomingMetadata(ctx, Metadata(req.Header))
-		ldap := LdapFromIncomingContext(ctx)
-		token := TokenFromIncomingContext(ctx)
-		rw := &responseWriter{ResponseWriter: w, buffer: bytes.NewBuffer(nil)}
-		stack := stack.New().
+		return log.ContextWithFields(ctx, stack.New().
 			Set("httpmethod", req.Method).
 			Set("path", req.URL.Path).
-			Set("ldap", ldap).
-			Set("token", token)
-		var err error
-		defer span.FinishWithFields(&err, stack)
-		reqData, reqBody, err := httpx.DrainBody(req.Body)
-		if err != nil {
-			stack.Set("httpStatusCode", rw.statusCode)
-			log.WithFields(stack).
-				ErrorContext(ctx, err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		start := time.Now()
-		stack.Set("reqData", string(reqData)).
-			Set("handleStart", start.Format("2006-01-02 15:04:05"))
-		log.WithFields(stack).
-			InfoContext(ctx, "recv req")
-		req = req.WithContext(ctx)
-		req.Body = reqBody
-		if next != nil {
-			next.ServeHTTP(rw, req)
-			if rw.statusCode == 0 {
-				rw.statusCode = http.StatusOK
-			}
-		}
-		statusCode := rw.Header().Get(StatusCodeHeader)
-		statusMsg := rw.Header().Get(StatusMsgHeader)
-		end := time.Now()
-		stack.Set("respData", string(rw.buffer.Bytes())).
-			Set("httpStatusCode", rw.statusCode).
-			Set("statusCode", statusCode).
-			Set("statusMsg", statusMsg).
-			Set("handleEnd", end.Format("2006-01-02 15:04:05"))
-		log.WithField("respData", string(rw.buffer.Bytes())).
-			WithField("httpStatusCode", rw.statusCode).
-			WithField("statusCode", statusCode).
-			WithField("statusMsg", statusMsg).
-			WithField("handleEnd", end.Format("2006-01-02 15:04:05")).
-			InfoContext(ctx, "finish req")
-	})
+			Set("ldap", LdapFromIncomingContext(ctx)).
+			Set("rpcCaller", CallerFromIncomingContext(ctx)).
+			Set("remoteAddr", req.RemoteAddr))
+	},
+	Fields: func(ctx context.Context) stack.Fields {
+		return stack.New().
+			Set("token", TokenFromIncomingContext(ctx))
+	},
+	FinishFields: func(header http.Header) stack.Fields {
+		return stack.New().
+			Set("statusCode", header.Get(StatusCodeHeader)).
+			Set("statusMsg", header.Get(StatusMsgHeader))
+	},
 }
 
 func metrics(next http.Handler) http.Handler {
@@ -336,30 +305,3 @@ func metrics(next http.Handler) http.Handler {
 		}
 	})
 }
-
-func recovery(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		defer func() {
-			ctx := req.Context()
-			if e := recover(); e != nil {
-				if e == http.ErrAbortHandler {
-					panic(http.ErrAbortHandler)
-				}
-				var err error
-				switch v := e.(type) {
-				case error:
-					err = v
-				default:
-					err = fmt.Errorf("%+v", v)
-				}
-				stack := stack.Callers(stack.StdFilter)
-				log.WithField("stack", stack).
-					ErrorContext(ctx, err)
-				w.WriteHeader(http.StatusInternalServerError)
-			}
-		}()
-		if next != nil {
-			next.ServeHTTP(w, req)
-		}
-	})
-}
@@ -9,6 +9,7 @@ type ServerOptions struct {
 	codec        Codec
 	interceptors []interceptor.ServerInterceptor
 	router       Router
+	conf         interface{}
 }
 
 // ServerOption ServerOption
@@ -42,3 +43,10 @@ func ServerWithInterceptors(interceptors ...interceptor.ServerInterceptor) Serve
 		o.interceptors = interceptors
 	}
 }
+
+// ServerWithConf ServerWithConf
+func ServerWithConf(conf interface{}) ServerOption {
+	return func(o *ServerOptions) {
+		o.conf = conf
+	}
+}
@@ -3,10 +3,14 @@ package rpc_test
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/wwq-2020/go.common/errorsx"
+	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/rpc"
 	"github.com/wwq-2020/go.common/rpc/interceptor"
 )
@@ -70,3 +74,35 @@ func TestServer(t *testing.T) {
 	fmt.Println(c.Invoke(ctx, "/a", req{Data: "xx"}, respObj), respObj)
 	time.Sleep(time.Second * 2)
 }
+
+func TestServerStartAdminAddrInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected:%v,got:%v", nil, err)
+	}
+	defer ln.Close()
+	s := rpc.NewServer(&rpc.ServerConf{
+		Addr:  "127.0.0.1:0",
+		Admin: &rpc.AdminConf{Addr: ln.Addr().String()},
+	})
+	if err := s.Start(); err == nil {
+		t.Fatalf("expected:%v,got:%v", "addr in use", err)
+	}
+}
+
+func TestTraceContextFields(t *testing.T) {
+	var got map[string]interface{}
+	handler := rpc.WrapHTTPHandler(func(w http.ResponseWriter, r *http.Request) {
+		got = log.FieldsFromContext(r.Context()).KVs()
+	})
+	req := httptest.NewRequest(http.MethodPost, "/svc/method", nil)
+	req.Header.Set(rpc.LdapKey, "alice")
+	req.Header.Set(rpc.CallerKey, "order-service")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if got["rpcCaller"] != "order-service" {
+		t.Fatalf("expected:%s,got:%v", "order-service", got["rpcCaller"])
+	}
+	if got["ldap"] != "alice" || got["path"] != "/svc/method" {
+		t.Fatalf("expected:%s,got:%v", "alice /svc/method", got)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/wwq-2020/go.common/errorsx"
-	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/stack"
 	"github.com/wwq-2020/go.common/tracing"
 )
@@ -35,7 +34,7 @@ func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driv
 	span, ctx := tracing.StartSpan(ctx, "ExecContext")
 	stack := stack.New().Set("query", query).Set("args", args)
 	defer span.FinishWithFields(&err, stack)
-	log.WithFields(stack).
+	logger().WithFields(stack).
 		InfoContext(ctx, "ExecContext")
 	conn := c.Conn
 	queryerCtx, ok := conn.(driver.ExecerContext)
@@ -74,7 +73,7 @@ func (c *wrappedConn) ExecContext(ctx context.Context, query string, args []driv
 func (c *wrappedConn) PrepareContext(ctx context.Context, query string) (_ driver.Stmt, err error) {
 	span, ctx := tracing.StartSpan(ctx, "PrepareContext")
 	defer span.WithField("query", query).Finish(&err)
-	log.WithField("query", query).
+	logger().WithField("query", query).
 		InfoContext(ctx, "PrepareContext")
 	var cancel context.CancelFunc
 	if _, ok := ctx.Deadline(); !ok {
@@ -105,7 +104,7 @@ func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []dri
 	span, ctx := tracing.StartSpan(ctx, "QueryContext")
 	stack := stack.New().Set("query", query).Set("args", args)
 	defer span.FinishWithFields(&err, stack)
-	log.WithFields(stack).
+	logger().WithFields(stack).
 		InfoContext(ctx, "QueryContext")
 	conn := c.Conn
 	queryerCtx, ok := conn.(driver.QueryerContext)
@@ -148,7 +147,7 @@ func (c *wrappedConn) QueryContext(ctx context.Context, query string, args []dri
 func (c *wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (_ driver.Tx, err error) {
 	span, ctx := tracing.StartSpan(ctx, "BeginTx")
 	defer span.WithField("opts", opts).Finish(&err)
-	log.WithField("opts", opts).
+	logger().WithField("opts", opts).
 		InfoContext(ctx, "BeginTx")
 	rc, ok := c.Conn.(driver.ConnBeginTx)
 	if !ok {
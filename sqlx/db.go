@@ -11,6 +11,13 @@ import (
 	"github.com/wwq-2020/go.common/log"
 )
 
+// LoggerName 可以通过log.SetLevelByName(LoggerName, ...)单独调整sqlx的日志级别
+const LoggerName = "sqlx"
+
+func logger() log.Logger {
+	return log.Named(LoggerName)
+}
+
 // Conf Conf
 type Conf struct {
 	User            string `json:"user" toml:"user" yaml:"user"`
@@ -41,7 +48,7 @@ func (c *Conf) Fill() {
 func MustOpen(conf *Conf) *sql.DB {
 	stdDB, err := Open(conf)
 	if err != nil {
-		log.WithError(err).
+		logger().WithError(err).
 			Fatal("failed to Open")
 	}
 	return stdDB
@@ -86,7 +93,7 @@ func Open(conf *Conf) (*sql.DB, error) {
 func MustOpenStd(conf *Conf) *sql.DB {
 	stdDB, err := OpenStd(conf)
 	if err != nil {
-		log.WithError(err).
+		logger().WithError(err).
 			Fatal("failed to OpenStd")
 	}
 	return stdDB
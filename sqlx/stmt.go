@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/wwq-2020/go.common/errorsx"
-	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/tracing"
 )
 
@@ -43,7 +42,7 @@ func (stmt *wrappedStmt) Close() error {
 func (stmt *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (_ driver.Result, err error) {
 	span, ctx := tracing.StartSpan(ctx, "ExecContext")
 	defer span.WithField("args", args).Finish(&err)
-	log.WithField("args", args).
+	logger().WithField("args", args).
 		InfoContext(ctx, "ExecContext")
 	rstmt, ok := stmt.Stmt.(driver.StmtExecContext)
 	if !ok {
@@ -68,7 +67,7 @@ func (stmt *wrappedStmt) ExecContext(ctx context.Context, args []driver.NamedVal
 func (stmt *wrappedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (_ driver.Rows, err error) {
 	span, ctx := tracing.StartSpan(ctx, "QueryContext")
 	defer span.WithField("args", args).Finish(&err)
-	log.WithField("args", args).
+	logger().WithField("args", args).
 		InfoContext(ctx, "QueryContext")
 	rstmt, ok := stmt.Stmt.(driver.StmtQueryContext)
 	if !ok {
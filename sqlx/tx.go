@@ -5,7 +5,6 @@ import (
 	"database/sql/driver"
 
 	"github.com/wwq-2020/go.common/errorsx"
-	"github.com/wwq-2020/go.common/log"
 	"github.com/wwq-2020/go.common/tracing"
 )
 
@@ -36,7 +35,7 @@ func (tx *wrappedTx) Commit() (err error) {
 	}
 	span, ctx := tracing.StartSpan(tx.ctx, "Commit")
 	defer span.Finish(&err)
-	log.InfoContext(ctx, "Commit")
+	logger().InfoContext(ctx, "Commit")
 	if err = tx.tx.Commit(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -49,7 +48,7 @@ func (tx *wrappedTx) Rollback() (err error) {
 	}
 	span, ctx := tracing.StartSpan(tx.ctx, "Rollback")
 	defer span.Finish(&err)
-	log.InfoContext(ctx, "Rollback")
+	logger().InfoContext(ctx, "Rollback")
 	if err = tx.tx.Rollback(); err != nil {
 		return errorsx.Trace(err)
 	}
@@ -32,6 +32,15 @@ func Caller(depth int) string {
 	return fmt.Sprintf("%s@%s:%d", function, trimFile(file), line)
 }
 
+// FullCaller 完整的函数名与文件路径
+func FullCaller(depth int) string {
+	pc, file, line, ok := runtime.Caller(depth + 1)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s:%d", runtime.FuncForPC(pc).Name(), file, line)
+}
+
 // Callers Callers
 func Callers(filters ...func(string) bool) string {
 	filter := combineFilter(append(filters, stackfilter)...)